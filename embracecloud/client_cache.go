@@ -0,0 +1,94 @@
+package embracecloud
+
+import (
+	"sync"
+)
+
+// clientKey identifies a client by the client id shown in the admin console
+type clientKey struct {
+	realm    string
+	clientId string
+}
+
+// clientCache remembers the ids of clients, which every client role operation
+// needs but terraform only knows the client id of. Concurrent lookups of the
+// same client wait for a single request.
+type clientCache struct {
+	mu      sync.Mutex
+	entries map[clientKey]*clientCacheEntry
+	keys    map[clientKey]string
+}
+
+type clientCacheEntry struct {
+	mu sync.Mutex
+	id string
+}
+
+// lookup returns the cached id of the client or fetches it. Failed fetches
+// are not cached.
+func (c *clientCache) lookup(key clientKey, fetch func() (string, error)) (string, error) {
+	c.mu.Lock()
+	c.init()
+	entry := c.entries[key]
+	if entry == nil {
+		entry = &clientCacheEntry{}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+
+	if entry.id != "" {
+		return entry.id, nil
+	}
+
+	id, err := fetch()
+	if err != nil {
+		return "", err
+	}
+	entry.id = id
+
+	c.mu.Lock()
+	c.keys[key] = id
+	c.mu.Unlock()
+
+	return id, nil
+}
+
+// remember caches the id of a client that was listed with the other clients
+// of its realm. A client that is already cached or being looked up is left
+// alone.
+func (c *clientCache) remember(key clientKey, id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.init()
+	if _, ok := c.entries[key]; ok {
+		return
+	}
+	c.entries[key] = &clientCacheEntry{id: id}
+	c.keys[key] = id
+}
+
+// init creates the maps of the cache, c.mu is held by the caller
+func (c *clientCache) init() {
+	if c.entries == nil {
+		c.entries = map[clientKey]*clientCacheEntry{}
+		c.keys = map[clientKey]string{}
+	}
+}
+
+// forget drops the client with the given id, keycloak answered 404 for it so
+// it may have been deleted or recreated with a new id
+func (c *clientCache) forget(realm string, idOfClient string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, id := range c.keys {
+		if key.realm == realm && id == idOfClient {
+			delete(c.entries, key)
+			delete(c.keys, key)
+		}
+	}
+}
@@ -2,29 +2,273 @@ package embracecloud
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/Nerzal/gocloak/v12"
 )
 
+// tokens are renewed this long before keycloak considers them expired so a
+// request never leaves with a token that runs out while it is in flight
+const tokenExpiryMargin = 30 * time.Second
+
+const (
+	GrantTypeClientCredentials = "client_credentials"
+	GrantTypePassword          = "password"
+	GrantTypeAccessToken       = "access_token"
+)
+
+// client used for the password grant when no client id is configured
+const defaultPasswordClientId = "admin-cli"
+
+// KeycloakConfig holds everything needed to connect and authenticate against
+// keycloak. Which credentials are used depends on GrantType.
+type KeycloakConfig struct {
+	Url          string
+	Realm        string
+	GrantType    string
+	ClientId     string
+	ClientSecret string
+	Username     string
+	Password     string
+	AccessToken  string
+
+	CACert                string
+	ClientCert            string
+	ClientKey             string
+	TLSInsecureSkipVerify bool
+	ProxyUrl              string
+	Timeout               time.Duration
+	Headers               map[string]string
+
+	MaxRetries   int
+	MaxRetryWait time.Duration
+
+	MaxConcurrentRequests int
+	RequestsPerSecond     float64
+}
+
+// provider settings that have to be set for each grant type, they are checked
+// on first use since they may still be unknown while the provider is configured
+var requiredSettings = map[string][]struct {
+	name  string
+	value func(config KeycloakConfig) string
+}{
+	GrantTypeClientCredentials: {
+		{"keycloak_url", func(c KeycloakConfig) string { return c.Url }},
+		{"keycloak_client_id", func(c KeycloakConfig) string { return c.ClientId }},
+		{"keycloak_client_secret", func(c KeycloakConfig) string { return c.ClientSecret }},
+	},
+	GrantTypePassword: {
+		{"keycloak_url", func(c KeycloakConfig) string { return c.Url }},
+		{"keycloak_username", func(c KeycloakConfig) string { return c.Username }},
+		{"keycloak_password", func(c KeycloakConfig) string { return c.Password }},
+	},
+	GrantTypeAccessToken: {
+		{"keycloak_url", func(c KeycloakConfig) string { return c.Url }},
+		{"keycloak_access_token", func(c KeycloakConfig) string { return c.AccessToken }},
+	},
+}
+
+// MissingSettings returns the names of the settings the grant type needs
+// that are not set
+func (config KeycloakConfig) MissingSettings() []string {
+	var missing []string
+	for _, setting := range requiredSettings[config.GrantType] {
+		if setting.value(config) == "" {
+			missing = append(missing, setting.name)
+		}
+	}
+
+	return missing
+}
+
+// Validate reports the settings the grant type needs that are missing
+func (config KeycloakConfig) Validate() error {
+	if _, ok := requiredSettings[config.GrantType]; !ok {
+		return fmt.Errorf("unsupported keycloak grant type %s", config.GrantType)
+	}
+
+	if missing := config.MissingSettings(); len(missing) > 0 {
+		return fmt.Errorf("keycloak is not configured, %s must be set when keycloak_enabled is true and keycloak_grant_type is %s", strings.Join(missing, ", "), config.GrantType)
+	}
+
+	return nil
+}
+
 type EmbraceCloudClient struct {
-	keycloack         gocloak.GoCloak
+	keycloack         *gocloak.GoCloak
 	keycloak_token    gocloak.JWT
 	keycloack_enabled bool
+
+	keycloak_config         KeycloakConfig
+	keycloak_init_lock      sync.Mutex
+	keycloak_initialised    bool
+	keycloak_token_expiry   time.Time
+	keycloak_refresh_expiry time.Time
+	keycloak_token_lock     sync.Mutex
+	keycloak_api            KeycloakAPI
+	keycloak_clients        clientCache
+}
+
+// ConfigureKeycloak enables keycloak without contacting it. The connection is
+// set up and the login is done by the first keycloak call, so
+// validate and plan work while the keycloak url is still unknown.
+func (cc *EmbraceCloudClient) ConfigureKeycloak(config KeycloakConfig) {
+	if config.GrantType == "" {
+		config.GrantType = GrantTypeClientCredentials
+	}
+	if config.GrantType == GrantTypePassword && config.ClientId == "" {
+		config.ClientId = defaultPasswordClientId
+	}
+
+	cc.keycloak_config = config
+	cc.keycloack_enabled = true
 }
 
-func (cc *EmbraceCloudClient) InitKeycloak(ctx context.Context, url string, clientId string, clientSecret string) {
-	cc.keycloack = *gocloak.NewClient(url)
-	token, err := cc.keycloack.LoginClient(ctx, clientId, clientSecret, "master")
+// SetKeycloakAPI replaces the gocloak based KeycloakAPI, e.g. with a fake in
+// tests or with a decorator around NewGocloakAPI. It enables keycloak.
+func (cc *EmbraceCloudClient) SetKeycloakAPI(api KeycloakAPI) {
+	cc.keycloak_api = api
+	cc.keycloack_enabled = true
+}
+
+// GetKeycloakClient returns the KeycloakAPI the resources work with. For the
+// default gocloak implementation it makes sure the login succeeded, so
+// configuration and credential problems are reported before the first call.
+func (cc *EmbraceCloudClient) GetKeycloakClient(ctx context.Context) (KeycloakAPI, error) {
+	if !cc.keycloack_enabled {
+		return nil, errors.New("keycloak is not enabled, set keycloak_enabled in the provider configuration")
+	}
+
+	if cc.keycloak_api != nil {
+		return cc.keycloak_api, nil
+	}
+
+	if _, _, err := cc.session(ctx); err != nil {
+		return nil, err
+	}
+
+	return NewGocloakAPI(cc), nil
+}
+
+// session returns the gocloak client together with a token that is valid for
+// at least tokenExpiryMargin. The first call logs in, concurrent callers wait
+// for it. Expired tokens are refreshed, or a new login is done when the
+// refresh token is expired as well. Concurrent callers wait for a single
+// refresh and share its result. A static access token is handed out as is,
+// it cannot be renewed by the provider.
+func (cc *EmbraceCloudClient) session(ctx context.Context) (*gocloak.GoCloak, gocloak.JWT, error) {
+	if err := cc.ensureInitialised(ctx); err != nil {
+		return nil, gocloak.JWT{}, err
+	}
+
+	cc.keycloak_token_lock.Lock()
+	defer cc.keycloak_token_lock.Unlock()
+
+	if cc.keycloak_config.GrantType != GrantTypeAccessToken && time.Now().After(cc.keycloak_token_expiry) {
+		if err := cc.refresh(ctx); err != nil {
+			return nil, gocloak.JWT{}, err
+		}
+	}
+
+	return cc.keycloack, cc.keycloak_token, nil
+}
+
+// ensureInitialised sets up the connection and logs in unless that succeeded
+// before. A failed attempt is not remembered, a timeout, a keycloak that is
+// restarting or a cancelled context only fail the caller that ran into them.
+func (cc *EmbraceCloudClient) ensureInitialised(ctx context.Context) error {
+	cc.keycloak_init_lock.Lock()
+	defer cc.keycloak_init_lock.Unlock()
+
+	if cc.keycloak_initialised {
+		return nil
+	}
+	if err := cc.initKeycloak(ctx); err != nil {
+		return err
+	}
+	cc.keycloak_initialised = true
+
+	return nil
+}
+
+func (cc *EmbraceCloudClient) initKeycloak(ctx context.Context) error {
+	config := cc.keycloak_config
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	keycloak := gocloak.NewClient(config.Url)
+	if err := configureTransport(keycloak, config); err != nil {
+		return err
+	}
+	cc.keycloack = keycloak
+
+	return cc.login(ctx)
+}
+
+func (cc *EmbraceCloudClient) login(ctx context.Context) error {
+	config := cc.keycloak_config
+
+	var token *gocloak.JWT
+	var err error
+
+	switch config.GrantType {
+	case GrantTypeClientCredentials:
+		token, err = cc.keycloack.LoginClient(ctx, config.ClientId, config.ClientSecret, config.Realm)
+	case GrantTypePassword:
+		token, err = cc.keycloack.Login(ctx, config.ClientId, config.ClientSecret, config.Realm, config.Username, config.Password)
+	case GrantTypeAccessToken:
+		token = &gocloak.JWT{AccessToken: config.AccessToken}
+	default:
+		return fmt.Errorf("unsupported keycloak grant type %s", config.GrantType)
+	}
 
 	if err != nil {
+		return newLoginError(config.Url, config.Realm, config.ClientId, err)
+	}
 
+	cc.setToken(token)
+	return nil
+}
+
+// refresh renews the access token with the refresh token when keycloak handed
+// one out and it is still valid, otherwise it logs in again
+func (cc *EmbraceCloudClient) refresh(ctx context.Context) error {
+	config := cc.keycloak_config
+
+	if cc.keycloak_token.RefreshToken != "" && time.Now().Before(cc.keycloak_refresh_expiry) {
+		token, err := cc.keycloack.RefreshToken(ctx, cc.keycloak_token.RefreshToken, config.ClientId, config.ClientSecret, config.Realm)
+		if err == nil {
+			cc.setToken(token)
+			return nil
+		}
 	}
+
+	return cc.login(ctx)
+}
+
+func (cc *EmbraceCloudClient) setToken(token *gocloak.JWT) {
+	now := time.Now()
 	cc.keycloak_token = *token
-	cc.keycloack_enabled = true
+	cc.keycloak_token_expiry = expiresAt(now, token.ExpiresIn)
+	cc.keycloak_refresh_expiry = expiresAt(now, token.RefreshExpiresIn)
 }
 
-func (cc *EmbraceCloudClient) GetKeycloakClient() (*gocloak.GoCloak, gocloak.JWT) {
-	return &cc.keycloack, cc.keycloak_token
+// expiresAt converts a lifetime in seconds as returned by keycloak into the
+// moment the token has to be renewed. Short lived tokens are renewed halfway.
+func expiresAt(issued time.Time, expiresIn int) time.Time {
+	lifetime := time.Duration(expiresIn) * time.Second
+	margin := tokenExpiryMargin
+	if lifetime < 2*margin {
+		margin = lifetime / 2
+	}
+
+	return issued.Add(lifetime - margin)
 }
 
 func BuildClient() *EmbraceCloudClient {
@@ -0,0 +1,217 @@
+package embracecloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Nerzal/gocloak/v12"
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+)
+
+const tokenPath = "/protocol/openid-connect/token$"
+
+// testConfig returns the settings to log in to server with the client
+// credentials grant
+func testConfig(server *keycloaktest.Server) KeycloakConfig {
+	return KeycloakConfig{
+		Url:          server.URL,
+		Realm:        "master",
+		ClientId:     server.ClientId,
+		ClientSecret: server.ClientSecret,
+	}
+}
+
+func testClient(config KeycloakConfig) *EmbraceCloudClient {
+	client := BuildClient()
+	client.ConfigureKeycloak(config)
+	return client
+}
+
+// testGetClients makes an admin api call with the token of client
+func testGetClients(t *testing.T, client *EmbraceCloudClient) {
+	t.Helper()
+
+	api, err := client.GetKeycloakClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.GetClients(context.Background(), "master", gocloak.GetClientsParams{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionRefreshesExpiredToken(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	client := testClient(testConfig(server))
+	testGetClients(t, client)
+
+	// the access token ran out while the refresh token is still valid
+	first := client.keycloak_token
+	client.keycloak_token_expiry = time.Now().Add(-time.Second)
+
+	testGetClients(t, client)
+	if client.keycloak_token.AccessToken == first.AccessToken {
+		t.Fatal("expected the expired access token to be replaced")
+	}
+	if got := server.RequestCount(http.MethodPost, tokenPath); got != 2 {
+		t.Errorf("expected a login and a refresh, got %d token requests", got)
+	}
+}
+
+func TestSessionLogsInAgainWhenRefreshTokenExpired(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	client := testClient(testConfig(server))
+	testGetClients(t, client)
+
+	client.keycloak_token_expiry = time.Now().Add(-time.Second)
+	client.keycloak_refresh_expiry = time.Now().Add(-time.Second)
+	client.keycloak_token.RefreshToken = "expired"
+
+	testGetClients(t, client)
+	if got := server.RequestCount(http.MethodPost, tokenPath); got != 2 {
+		t.Errorf("expected two logins, got %d token requests", got)
+	}
+}
+
+func TestSessionRefreshesTokenKeycloakExpires(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	server.TokenLifetime = 2 * time.Second
+	client := testClient(testConfig(server))
+	testGetClients(t, client)
+
+	// short lived tokens are renewed halfway through their lifetime, so the
+	// call after that uses a new one even though the old one is still valid
+	time.Sleep(1100 * time.Millisecond)
+	testGetClients(t, client)
+	if got := server.RequestCount(http.MethodPost, tokenPath); got != 2 {
+		t.Errorf("expected the token to be refreshed once, got %d token requests", got)
+	}
+}
+
+func TestExpiresAt(t *testing.T) {
+	issued := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		expiresIn int
+		expected  time.Duration
+	}{
+		{300, 270 * time.Second},
+		{60, 30 * time.Second},
+		{20, 10 * time.Second},
+		{0, 0},
+	}
+	for _, test := range tests {
+		if got := expiresAt(issued, test.expiresIn).Sub(issued); got != test.expected {
+			t.Errorf("expected a token valid for %ds to be renewed after %s, got %s", test.expiresIn, test.expected, got)
+		}
+	}
+}
+
+func TestPasswordGrant(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	client := testClient(KeycloakConfig{
+		Url:       server.URL,
+		Realm:     "master",
+		GrantType: GrantTypePassword,
+		Username:  server.Username,
+		Password:  server.Password,
+	})
+
+	testGetClients(t, client)
+	if client.keycloak_config.ClientId != defaultPasswordClientId {
+		t.Errorf("expected the password grant to default to client %s, got %s", defaultPasswordClientId, client.keycloak_config.ClientId)
+	}
+}
+
+func TestAccessTokenGrant(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	issuer := testClient(testConfig(server))
+	testGetClients(t, issuer)
+
+	client := testClient(KeycloakConfig{
+		Url:         server.URL,
+		Realm:       "master",
+		GrantType:   GrantTypeAccessToken,
+		AccessToken: issuer.keycloak_token.AccessToken,
+	})
+	testGetClients(t, client)
+	if got := server.RequestCount(http.MethodPost, tokenPath); got != 1 {
+		t.Errorf("expected the access token to be used without a login, got %d token requests", got)
+	}
+}
+
+func TestKeycloakConfigValidate(t *testing.T) {
+	tests := []struct {
+		config   KeycloakConfig
+		expected string
+	}{
+		{
+			KeycloakConfig{GrantType: GrantTypeClientCredentials, Url: "https://keycloak", ClientId: "terraform"},
+			"keycloak is not configured, keycloak_client_secret must be set when keycloak_enabled is true and keycloak_grant_type is client_credentials",
+		},
+		{
+			KeycloakConfig{GrantType: GrantTypePassword, Url: "https://keycloak"},
+			"keycloak is not configured, keycloak_username, keycloak_password must be set when keycloak_enabled is true and keycloak_grant_type is password",
+		},
+		{
+			KeycloakConfig{GrantType: GrantTypeAccessToken},
+			"keycloak is not configured, keycloak_url, keycloak_access_token must be set when keycloak_enabled is true and keycloak_grant_type is access_token",
+		},
+		{
+			KeycloakConfig{GrantType: "implicit"},
+			"unsupported keycloak grant type implicit",
+		},
+		{
+			KeycloakConfig{GrantType: GrantTypeAccessToken, Url: "https://keycloak", AccessToken: "token"},
+			"",
+		},
+	}
+	for _, test := range tests {
+		err := test.config.Validate()
+		if got := fmt.Sprint(err); (err == nil && test.expected != "") || (err != nil && got != test.expected) {
+			t.Errorf("expected %q, got %v", test.expected, err)
+		}
+	}
+}
+
+func TestSessionRetriesFailedLogin(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	client := testClient(testConfig(server))
+	server.InjectFault(keycloaktest.Fault{
+		Method: http.MethodPost,
+		Path:   tokenPath,
+		Status: http.StatusServiceUnavailable,
+		Times:  1,
+	})
+
+	if _, err := client.GetKeycloakClient(context.Background()); err == nil {
+		t.Fatal("expected the first login to fail")
+	}
+	testGetClients(t, client)
+}
+
+func TestSessionRetriesCancelledLogin(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	client := testClient(testConfig(server))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.GetKeycloakClient(ctx); err == nil {
+		t.Fatal("expected the login with a cancelled context to fail")
+	}
+	testGetClients(t, client)
+}
+
+func TestSessionLogsInOnce(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	server.InjectFault(keycloaktest.Fault{Method: http.MethodPost, Path: tokenPath, Delay: 50 * time.Millisecond})
+	client := testClient(testConfig(server))
+
+	testParallelGetClients(t, client, 8)
+	if got := server.RequestCount(http.MethodPost, tokenPath); got != 1 {
+		t.Errorf("expected concurrent callers to share one login, got %d token requests", got)
+	}
+}
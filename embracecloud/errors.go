@@ -0,0 +1,83 @@
+package embracecloud
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v12"
+)
+
+const (
+	LoginErrorNetwork     = "network error"
+	LoginErrorTLS         = "tls error"
+	LoginErrorCredentials = "invalid credentials"
+	LoginErrorRealm       = "realm not found"
+	LoginErrorUnknown     = "unexpected error"
+)
+
+// LoginError is returned when the provider cannot log in to keycloak. Cause is
+// one of the LoginError constants and tells the user where to start looking.
+type LoginError struct {
+	Url      string
+	Realm    string
+	ClientId string
+	Cause    string
+	Err      error
+}
+
+func (e *LoginError) Error() string {
+	return fmt.Sprintf("could not log in to keycloak at %s in realm %s with client %s (%s) error -> %s", e.Url, e.Realm, e.ClientId, e.Cause, e.Err.Error())
+}
+
+func (e *LoginError) Unwrap() error {
+	return e.Err
+}
+
+func newLoginError(url string, realm string, clientId string, err error) *LoginError {
+	return &LoginError{
+		Url:      url,
+		Realm:    realm,
+		ClientId: clientId,
+		Cause:    loginErrorCause(err),
+		Err:      err,
+	}
+}
+
+// loginErrorCause classifies the error of a token request. gocloak flattens
+// transport errors into the message of an APIError with code 0, so those are
+// told apart by their text.
+func loginErrorCause(err error) string {
+	var apiErr *gocloak.APIError
+	if !errors.As(err, &apiErr) {
+		return LoginErrorUnknown
+	}
+
+	switch {
+	case apiErr.Code == 0 && (strings.Contains(apiErr.Message, "x509:") || strings.Contains(apiErr.Message, "tls:")):
+		return LoginErrorTLS
+	case apiErr.Code == 0:
+		return LoginErrorNetwork
+	case apiErr.Code == 404:
+		return LoginErrorRealm
+	case apiErr.Code == 400 || apiErr.Code == 401:
+		return LoginErrorCredentials
+	default:
+		return LoginErrorUnknown
+	}
+}
+
+// IsNotFound tells whether err, or an error it wraps, is keycloak answering
+// 404 or a client that does not exist
+func IsNotFound(err error) bool {
+	var apiErr *gocloak.APIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// IsConflict tells whether err, or an error it wraps, is keycloak answering
+// 409, e.g. for a role name that is already taken
+func IsConflict(err error) bool {
+	var apiErr *gocloak.APIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusConflict
+}
@@ -0,0 +1,57 @@
+package embracecloud
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v12"
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+)
+
+func TestLoginErrorCause(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	tlsServer := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(tlsServer.Close)
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	tests := []struct {
+		name   string
+		modify func(config *KeycloakConfig)
+		cause  string
+	}{
+		{"wrong secret", func(config *KeycloakConfig) { config.ClientSecret = "wrong" }, LoginErrorCredentials},
+		{"unknown realm", func(config *KeycloakConfig) { config.Realm = "missing" }, LoginErrorRealm},
+		{"unreachable", func(config *KeycloakConfig) { config.Url = closed.URL }, LoginErrorNetwork},
+		{"untrusted certificate", func(config *KeycloakConfig) { config.Url = tlsServer.URL }, LoginErrorTLS},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := testConfig(server)
+			test.modify(&config)
+
+			_, err := testClient(config).GetKeycloakClient(context.Background())
+			var loginErr *LoginError
+			if !errors.As(err, &loginErr) {
+				t.Fatalf("expected a login error, got %v", err)
+			}
+			if loginErr.Cause != test.cause {
+				t.Errorf("expected cause %q, got %q in %v", test.cause, loginErr.Cause, err)
+			}
+		})
+	}
+}
+
+func TestLoginErrorCauseUnknown(t *testing.T) {
+	for _, err := range []error{
+		errors.New("not an api error"),
+		&gocloak.APIError{Code: http.StatusInternalServerError, Message: "500 Internal Server Error"},
+	} {
+		if cause := loginErrorCause(err); cause != LoginErrorUnknown {
+			t.Errorf("expected %v to be classified as %q, got %q", err, LoginErrorUnknown, cause)
+		}
+	}
+}
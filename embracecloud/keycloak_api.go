@@ -0,0 +1,394 @@
+package embracecloud
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v12"
+)
+
+// page size for admin api lists that are fetched completely
+const adminPageSize = 100
+
+// KeycloakAPI is the part of the keycloak admin api the provider uses. The
+// implementation takes care of authentication, so unlike gocloak no access
+// token is passed in.
+type KeycloakAPI interface {
+	GetClients(ctx context.Context, realm string, params gocloak.GetClientsParams) ([]*gocloak.Client, error)
+	// GetClientUUID returns the id of the client with the given client id
+	GetClientUUID(ctx context.Context, realm string, clientId string) (string, error)
+	// GetClientUUIDs returns the ids of all clients of the realm
+	GetClientUUIDs(ctx context.Context, realm string) ([]string, error)
+	GetClient(ctx context.Context, realm string, idOfClient string) (*gocloak.Client, error)
+	GetClientServiceAccount(ctx context.Context, realm string, idOfClient string) (*gocloak.User, error)
+
+	CreateRealmRole(ctx context.Context, realm string, role gocloak.Role) (string, error)
+	GetRealmRole(ctx context.Context, realm string, roleName string) (*gocloak.Role, error)
+	GetRealmRoleByID(ctx context.Context, realm string, roleID string) (*gocloak.Role, error)
+	GetRealmRoles(ctx context.Context, realm string, params gocloak.GetRoleParams) ([]*gocloak.Role, error)
+	UpdateRealmRole(ctx context.Context, realm string, roleName string, role gocloak.Role) error
+	DeleteRealmRole(ctx context.Context, realm string, roleName string) error
+
+	CreateClientRole(ctx context.Context, realm string, idOfClient string, role gocloak.Role) (string, error)
+	GetClientRole(ctx context.Context, realm string, idOfClient string, roleName string) (*gocloak.Role, error)
+	GetClientRoles(ctx context.Context, realm string, idOfClient string, params gocloak.GetRoleParams) ([]*gocloak.Role, error)
+	UpdateRole(ctx context.Context, realm string, idOfClient string, role gocloak.Role) error
+	DeleteClientRole(ctx context.Context, realm string, idOfClient string, roleName string) error
+	// UpdateRoleByID updates a realm or client role addressed by its id. The
+	// roles are renamed with it, UpdateRole finds the role by the name in the
+	// body, which does not exist yet when renaming.
+	UpdateRoleByID(ctx context.Context, realm string, roleID string, role gocloak.Role) error
+
+	AddRealmRoleComposite(ctx context.Context, realm string, roleName string, roles []gocloak.Role) error
+	DeleteRealmRoleComposite(ctx context.Context, realm string, roleName string, roles []gocloak.Role) error
+	AddClientRoleComposite(ctx context.Context, realm string, roleID string, roles []gocloak.Role) error
+	DeleteClientRoleComposite(ctx context.Context, realm string, roleID string, roles []gocloak.Role) error
+	GetCompositeRolesByRoleID(ctx context.Context, realm string, roleID string) ([]*gocloak.Role, error)
+
+	GetUsersByRoleName(ctx context.Context, realm string, roleName string) ([]*gocloak.User, error)
+	GetUsersByClientRoleName(ctx context.Context, realm string, idOfClient string, roleName string) ([]*gocloak.User, error)
+	GetGroupsByRole(ctx context.Context, realm string, roleName string) ([]*gocloak.Group, error)
+	GetGroupsByClientRole(ctx context.Context, realm string, idOfClient string, roleName string) ([]*gocloak.Group, error)
+	AddRealmRoleToUser(ctx context.Context, realm string, userID string, roles []gocloak.Role) error
+	AddClientRoleToUser(ctx context.Context, realm string, idOfClient string, userID string, roles []gocloak.Role) error
+	AddRealmRoleToGroup(ctx context.Context, realm string, groupID string, roles []gocloak.Role) error
+	AddClientRoleToGroup(ctx context.Context, realm string, idOfClient string, groupID string, roles []gocloak.Role) error
+
+	GetUserByID(ctx context.Context, realm string, userID string) (*gocloak.User, error)
+	UpdateUser(ctx context.Context, realm string, user gocloak.User) error
+}
+
+// gocloakAPI implements KeycloakAPI with gocloak, every call fetches a valid
+// token from the client first
+type gocloakAPI struct {
+	client *EmbraceCloudClient
+}
+
+// NewGocloakAPI returns the default KeycloakAPI of the client, decorators set
+// with SetKeycloakAPI can wrap it
+func NewGocloakAPI(client *EmbraceCloudClient) KeycloakAPI {
+	return &gocloakAPI{client: client}
+}
+
+func (api *gocloakAPI) GetClients(ctx context.Context, realm string, params gocloak.GetClientsParams) ([]*gocloak.Client, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return keycloak.GetClients(ctx, token.AccessToken, realm, params)
+}
+
+// GetClientUUID is cached by the EmbraceCloudClient until keycloak answers
+// 404 for an endpoint of the client
+func (api *gocloakAPI) GetClientUUID(ctx context.Context, realm string, clientId string) (string, error) {
+	return api.client.keycloak_clients.lookup(clientKey{realm: realm, clientId: clientId}, func() (string, error) {
+		clients, err := api.GetClients(ctx, realm, gocloak.GetClientsParams{ClientID: &clientId})
+		if err != nil {
+			return "", fmt.Errorf("cannot find client %s in realm %s error -> %w", clientId, realm, err)
+		}
+		if len(clients) < 1 {
+			return "", &gocloak.APIError{Code: http.StatusNotFound, Message: fmt.Sprintf("client %s not found in realm %s", clientId, realm)}
+		}
+		if len(clients) > 1 {
+			return "", fmt.Errorf("multiple clients with client id %s found in realm %s", clientId, realm)
+		}
+		return *clients[0].ID, nil
+	})
+}
+
+// GetClientUUIDs lists every client of the realm once, the ids it finds are
+// cached for GetClientUUID as well
+func (api *gocloakAPI) GetClientUUIDs(ctx context.Context, realm string) ([]string, error) {
+	clients, err := api.GetClients(ctx, realm, gocloak.GetClientsParams{})
+	if err != nil {
+		return nil, fmt.Errorf("cannot list the clients of realm %s error -> %w", realm, err)
+	}
+
+	var ids []string
+	for _, client := range clients {
+		if client.ClientID != nil {
+			api.client.keycloak_clients.remember(clientKey{realm: realm, clientId: *client.ClientID}, *client.ID)
+		}
+		ids = append(ids, *client.ID)
+	}
+	return ids, nil
+}
+
+// clientError forgets the cached id of the client when keycloak answered 404
+// for an endpoint of the client itself. A 404 from below the client, like one
+// of its roles, says nothing about the client and leaves the cache alone.
+func (api *gocloakAPI) clientError(realm string, idOfClient string, err error) error {
+	if IsNotFound(err) {
+		api.client.keycloak_clients.forget(realm, idOfClient)
+	}
+	return err
+}
+
+func (api *gocloakAPI) GetClient(ctx context.Context, realm string, idOfClient string) (*gocloak.Client, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	client, err := keycloak.GetClient(ctx, token.AccessToken, realm, idOfClient)
+	return client, api.clientError(realm, idOfClient, err)
+}
+
+func (api *gocloakAPI) GetClientServiceAccount(ctx context.Context, realm string, idOfClient string) (*gocloak.User, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	user, err := keycloak.GetClientServiceAccount(ctx, token.AccessToken, realm, idOfClient)
+	return user, api.clientError(realm, idOfClient, err)
+}
+
+func (api *gocloakAPI) CreateRealmRole(ctx context.Context, realm string, role gocloak.Role) (string, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return "", err
+	}
+	return keycloak.CreateRealmRole(ctx, token.AccessToken, realm, role)
+}
+
+func (api *gocloakAPI) GetRealmRole(ctx context.Context, realm string, roleName string) (*gocloak.Role, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return keycloak.GetRealmRole(ctx, token.AccessToken, realm, roleName)
+}
+
+func (api *gocloakAPI) GetRealmRoleByID(ctx context.Context, realm string, roleID string) (*gocloak.Role, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return keycloak.GetRealmRoleByID(ctx, token.AccessToken, realm, roleID)
+}
+
+func (api *gocloakAPI) UpdateRealmRole(ctx context.Context, realm string, roleName string, role gocloak.Role) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.UpdateRealmRole(ctx, token.AccessToken, realm, roleName, role)
+}
+
+func (api *gocloakAPI) GetRealmRoles(ctx context.Context, realm string, params gocloak.GetRoleParams) ([]*gocloak.Role, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return keycloak.GetRealmRoles(ctx, token.AccessToken, realm, params)
+}
+
+func (api *gocloakAPI) DeleteRealmRole(ctx context.Context, realm string, roleName string) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.DeleteRealmRole(ctx, token.AccessToken, realm, roleName)
+}
+
+func (api *gocloakAPI) CreateClientRole(ctx context.Context, realm string, idOfClient string, role gocloak.Role) (string, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return "", err
+	}
+	id, err := keycloak.CreateClientRole(ctx, token.AccessToken, realm, idOfClient, role)
+	return id, api.clientError(realm, idOfClient, err)
+}
+
+func (api *gocloakAPI) GetClientRole(ctx context.Context, realm string, idOfClient string, roleName string) (*gocloak.Role, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return keycloak.GetClientRole(ctx, token.AccessToken, realm, idOfClient, roleName)
+}
+
+func (api *gocloakAPI) GetClientRoles(ctx context.Context, realm string, idOfClient string, params gocloak.GetRoleParams) ([]*gocloak.Role, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	roles, err := keycloak.GetClientRoles(ctx, token.AccessToken, realm, idOfClient, params)
+	return roles, api.clientError(realm, idOfClient, err)
+}
+
+func (api *gocloakAPI) UpdateRole(ctx context.Context, realm string, idOfClient string, role gocloak.Role) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.UpdateRole(ctx, token.AccessToken, realm, idOfClient, role)
+}
+
+func (api *gocloakAPI) DeleteClientRole(ctx context.Context, realm string, idOfClient string, roleName string) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.DeleteClientRole(ctx, token.AccessToken, realm, idOfClient, roleName)
+}
+
+func (api *gocloakAPI) UpdateRoleByID(ctx context.Context, realm string, roleID string, role gocloak.Role) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	// roles-by-id serves client roles as well
+	return keycloak.UpdateRealmRoleByID(ctx, token.AccessToken, realm, roleID, role)
+}
+
+func (api *gocloakAPI) AddRealmRoleComposite(ctx context.Context, realm string, roleName string, roles []gocloak.Role) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.AddRealmRoleComposite(ctx, token.AccessToken, realm, roleName, roles)
+}
+
+func (api *gocloakAPI) DeleteRealmRoleComposite(ctx context.Context, realm string, roleName string, roles []gocloak.Role) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.DeleteRealmRoleComposite(ctx, token.AccessToken, realm, roleName, roles)
+}
+
+func (api *gocloakAPI) AddClientRoleComposite(ctx context.Context, realm string, roleID string, roles []gocloak.Role) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.AddClientRoleComposite(ctx, token.AccessToken, realm, roleID, roles)
+}
+
+func (api *gocloakAPI) DeleteClientRoleComposite(ctx context.Context, realm string, roleID string, roles []gocloak.Role) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.DeleteClientRoleComposite(ctx, token.AccessToken, realm, roleID, roles)
+}
+
+func (api *gocloakAPI) GetCompositeRolesByRoleID(ctx context.Context, realm string, roleID string) ([]*gocloak.Role, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return keycloak.GetCompositeRolesByRoleID(ctx, token.AccessToken, realm, roleID)
+}
+
+// keycloak lists at most 100 users or groups of a role unless first and max
+// are given, which gocloak does not support for all of these calls
+func (api *gocloakAPI) GetUsersByRoleName(ctx context.Context, realm string, roleName string) ([]*gocloak.User, error) {
+	return getAllPages[gocloak.User](ctx, api, realm, "roles", roleName, "users")
+}
+
+func (api *gocloakAPI) GetUsersByClientRoleName(ctx context.Context, realm string, idOfClient string, roleName string) ([]*gocloak.User, error) {
+	return getAllPages[gocloak.User](ctx, api, realm, "clients", idOfClient, "roles", roleName, "users")
+}
+
+func (api *gocloakAPI) GetGroupsByRole(ctx context.Context, realm string, roleName string) ([]*gocloak.Group, error) {
+	return getAllPages[gocloak.Group](ctx, api, realm, "roles", roleName, "groups")
+}
+
+func (api *gocloakAPI) GetGroupsByClientRole(ctx context.Context, realm string, idOfClient string, roleName string) ([]*gocloak.Group, error) {
+	return getAllPages[gocloak.Group](ctx, api, realm, "clients", idOfClient, "roles", roleName, "groups")
+}
+
+func (api *gocloakAPI) AddRealmRoleToUser(ctx context.Context, realm string, userID string, roles []gocloak.Role) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.AddRealmRoleToUser(ctx, token.AccessToken, realm, userID, roles)
+}
+
+func (api *gocloakAPI) AddClientRoleToUser(ctx context.Context, realm string, idOfClient string, userID string, roles []gocloak.Role) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.AddClientRoleToUser(ctx, token.AccessToken, realm, idOfClient, userID, roles)
+}
+
+func (api *gocloakAPI) AddRealmRoleToGroup(ctx context.Context, realm string, groupID string, roles []gocloak.Role) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.AddRealmRoleToGroup(ctx, token.AccessToken, realm, groupID, roles)
+}
+
+func (api *gocloakAPI) AddClientRoleToGroup(ctx context.Context, realm string, idOfClient string, groupID string, roles []gocloak.Role) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.AddClientRoleToGroup(ctx, token.AccessToken, realm, idOfClient, groupID, roles)
+}
+
+func (api *gocloakAPI) GetUserByID(ctx context.Context, realm string, userID string) (*gocloak.User, error) {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return keycloak.GetUserByID(ctx, token.AccessToken, realm, userID)
+}
+
+func (api *gocloakAPI) UpdateUser(ctx context.Context, realm string, user gocloak.User) error {
+	keycloak, token, err := api.client.session(ctx)
+	if err != nil {
+		return err
+	}
+	return keycloak.UpdateUser(ctx, token.AccessToken, realm, user)
+}
+
+// getAllPages fetches every page of an admin api list below the realm
+func getAllPages[T any](ctx context.Context, api *gocloakAPI, realm string, path ...string) ([]*T, error) {
+	segments := []string{strings.TrimSuffix(api.client.keycloak_config.Url, "/"), "admin", "realms", url.PathEscape(realm)}
+	for _, segment := range path {
+		segments = append(segments, url.PathEscape(segment))
+	}
+	listUrl := strings.Join(segments, "/")
+
+	var result []*T
+	for first := 0; ; first += adminPageSize {
+		keycloak, token, err := api.client.session(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var page []*T
+		var errorResponse gocloak.HTTPErrorResponse
+		resp, err := keycloak.RestyClient().R().
+			SetContext(ctx).
+			SetAuthToken(token.AccessToken).
+			SetQueryParams(map[string]string{"first": strconv.Itoa(first), "max": strconv.Itoa(adminPageSize)}).
+			SetResult(&page).
+			SetError(&errorResponse).
+			Get(listUrl)
+		if err != nil {
+			return nil, &gocloak.APIError{Message: err.Error(), Type: gocloak.ParseAPIErrType(err)}
+		}
+		if resp.IsError() {
+			message := resp.Status()
+			if errorResponse.NotEmpty() {
+				message += ": " + errorResponse.String()
+			}
+			return nil, &gocloak.APIError{Code: resp.StatusCode(), Message: message}
+		}
+
+		result = append(result, page...)
+		if len(page) < adminPageSize {
+			return result, nil
+		}
+	}
+}
@@ -0,0 +1,996 @@
+// Package keycloaktest provides an in-memory fake of the parts of the keycloak
+// admin api the provider uses, so resources can be tested without keycloak.
+package keycloaktest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Nerzal/gocloak/v12"
+)
+
+const (
+	DefaultClientId     = "terraform"
+	DefaultClientSecret = "secret"
+	DefaultUsername     = "admin"
+	DefaultPassword     = "admin"
+)
+
+// Fault makes matching requests fail or slow down instead of being handled
+type Fault struct {
+	// Method matches the http method, empty matches every method
+	Method string
+	// Path is a regular expression matched against the request path
+	Path string
+	// Status is answered instead of handling the request, 0 only delays it
+	Status int
+	// Delay is waited before the request is answered or handled
+	Delay time.Duration
+	// RetryAfter is sent as Retry-After header together with Status
+	RetryAfter string
+	// Times limits how many requests are affected, 0 means all of them
+	Times int
+
+	path *regexp.Regexp
+}
+
+// Server is a fake keycloak. Every realm accepts the tokens issued by the
+// token endpoint of any realm, like the admin api does for the master realm.
+type Server struct {
+	*httptest.Server
+
+	ClientId      string
+	ClientSecret  string
+	Username      string
+	Password      string
+	TokenLifetime time.Duration
+
+	mu       sync.Mutex
+	realms   map[string]*realm
+	tokens   map[string]time.Time
+	faults   []*Fault
+	requests []string
+	inFlight int
+	peak     int
+	nextId   int
+}
+
+type realm struct {
+	name    string
+	clients map[string]*client
+	roles   map[string]*role
+	users   map[string]*user
+	groups  map[string]*group
+}
+
+type client struct {
+	id                   string
+	clientId             string
+	serviceAccountUserId string
+}
+
+type role struct {
+	id          string
+	name        string
+	description string
+	attributes  map[string][]string
+	clientId    string
+	composites  map[string]bool
+}
+
+type user struct {
+	id        string
+	username  string
+	firstName string
+	lastName  string
+	roles     map[string]bool
+}
+
+type group struct {
+	id    string
+	name  string
+	roles map[string]bool
+}
+
+// NewServer starts a fake keycloak with a master realm. It is closed when the
+// test ends.
+func NewServer(t interface{ Cleanup(func()) }) *Server {
+	s := &Server{
+		ClientId:      DefaultClientId,
+		ClientSecret:  DefaultClientSecret,
+		Username:      DefaultUsername,
+		Password:      DefaultPassword,
+		TokenLifetime: 5 * time.Minute,
+		realms:        map[string]*realm{},
+		tokens:        map[string]time.Time{},
+	}
+	s.CreateRealm("master")
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+// InjectFault adds a fault, faults are checked in the order they were added
+func (s *Server) InjectFault(fault Fault) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	fault.path = regexp.MustCompile(fault.Path)
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes all injected faults
+func (s *Server) ClearFaults() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.faults = nil
+}
+
+// RequestCount returns how many requests matching method and the path regular
+// expression the server received, faulted ones included
+func (s *Server) RequestCount(method string, path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pattern := regexp.MustCompile(path)
+	count := 0
+	for _, request := range s.requests {
+		parts := strings.SplitN(request, " ", 2)
+		if (method == "" || parts[0] == method) && pattern.MatchString(parts[1]) {
+			count++
+		}
+	}
+
+	return count
+}
+
+// PeakConcurrentRequests returns the most requests the server handled at the
+// same time, delays of faults included
+func (s *Server) PeakConcurrentRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.peak
+}
+
+func (s *Server) CreateRealm(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.realms[name] = &realm{
+		name:    name,
+		clients: map[string]*client{},
+		roles:   map[string]*role{},
+		users:   map[string]*user{},
+		groups:  map[string]*group{},
+	}
+}
+
+// CreateClient adds a client with a service account and returns its id
+func (s *Server) CreateClient(realmName string, clientId string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.realms[realmName]
+	serviceAccount := &user{id: s.newId(), username: "service-account-" + clientId, roles: map[string]bool{}}
+	r.users[serviceAccount.id] = serviceAccount
+
+	c := &client{id: s.newId(), clientId: clientId, serviceAccountUserId: serviceAccount.id}
+	r.clients[c.id] = c
+
+	return c.id
+}
+
+// DeleteClient removes a client together with its roles and service account
+func (s *Server) DeleteClient(realmName string, clientId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.realms[realmName]
+	for id, c := range r.clients {
+		if c.clientId == clientId {
+			for _, rl := range r.roles {
+				if rl.clientId == id {
+					r.deleteRole(rl)
+				}
+			}
+			delete(r.users, c.serviceAccountUserId)
+			delete(r.clients, id)
+		}
+	}
+}
+
+// DisableServiceAccount removes the service account of the client with the
+// given clientId
+func (s *Server) DisableServiceAccount(realmName string, clientId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.realms[realmName]
+	c := r.clientByClientId(clientId)
+	delete(r.users, c.serviceAccountUserId)
+	c.serviceAccountUserId = ""
+}
+
+// CreateRealmRole adds a realm role and returns its id
+func (s *Server) CreateRealmRole(realmName string, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rl := &role{id: s.newId(), name: name, attributes: map[string][]string{}, composites: map[string]bool{}}
+	s.realms[realmName].roles[rl.id] = rl
+
+	return rl.id
+}
+
+// CreateClientRole adds a role to the client with the given clientId and
+// returns its id
+func (s *Server) CreateClientRole(realmName string, clientId string, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.realms[realmName]
+	c := r.clientByClientId(clientId)
+	rl := &role{id: s.newId(), name: name, attributes: map[string][]string{}, clientId: c.id, composites: map[string]bool{}}
+	r.roles[rl.id] = rl
+
+	return rl.id
+}
+
+// RealmRole returns the realm role with the given name or nil
+func (s *Server) RealmRole(realmName string, name string) *gocloak.Role {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rl := s.realms[realmName].roleByName("", name); rl != nil {
+		return rl.representation()
+	}
+	return nil
+}
+
+// ClientRole returns the role of the client with the given clientId or nil
+func (s *Server) ClientRole(realmName string, clientId string, name string) *gocloak.Role {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.realms[realmName]
+	c := r.clientByClientId(clientId)
+	if c == nil {
+		return nil
+	}
+	if rl := r.roleByName(c.id, name); rl != nil {
+		return rl.representation()
+	}
+	return nil
+}
+
+// UpdateRole overwrites description and attributes of the role with the given
+// id, as someone working in the admin console would
+func (s *Server) UpdateRole(realmName string, id string, description string, attributes map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rl := s.realms[realmName].roles[id]
+	rl.description = description
+	rl.attributes = attributes
+}
+
+// DeleteRole removes the role with the given id
+func (s *Server) DeleteRole(realmName string, id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.realms[realmName]
+	if rl := r.roles[id]; rl != nil {
+		r.deleteRole(rl)
+	}
+}
+
+// AddComposite makes the role with childId a composite of the one with parentId
+func (s *Server) AddComposite(realmName string, parentId string, childId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.realms[realmName].roles[parentId].composites[childId] = true
+}
+
+// RemoveComposite removes the role with childId from the composites of the
+// role with parentId
+func (s *Server) RemoveComposite(realmName string, parentId string, childId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.realms[realmName].roles[parentId].composites, childId)
+}
+
+// Composites returns the direct composites of the role with the given id
+func (s *Server) Composites(realmName string, id string) []*gocloak.Role {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r := s.realms[realmName]
+	return r.compositesOf(r.roles[id])
+}
+
+// CreateUser adds a user and returns its id
+func (s *Server) CreateUser(realmName string, username string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	u := &user{id: s.newId(), username: username, roles: map[string]bool{}}
+	s.realms[realmName].users[u.id] = u
+
+	return u.id
+}
+
+// CreateGroup adds a top level group and returns its id
+func (s *Server) CreateGroup(realmName string, name string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	g := &group{id: s.newId(), name: name, roles: map[string]bool{}}
+	s.realms[realmName].groups[g.id] = g
+
+	return g.id
+}
+
+// GrantRole maps the role with roleId to the user or group with holderId
+func (s *Server) GrantRole(realmName string, holderId string, roleId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.realms[realmName].holderRoles(holderId)[roleId] = true
+}
+
+// HasRole tells whether the role with roleId is mapped directly to the user
+// or group with holderId
+func (s *Server) HasRole(realmName string, holderId string, roleId string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.realms[realmName].holderRoles(holderId)[roleId]
+}
+
+// User returns the user with the given id or nil
+func (s *Server) User(realmName string, id string) *gocloak.User {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if u := s.realms[realmName].users[id]; u != nil {
+		return u.representation()
+	}
+	return nil
+}
+
+// ClientUUID returns the id of the client with the given clientId
+func (s *Server) ClientUUID(realmName string, clientId string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.realms[realmName].clientByClientId(clientId).id
+}
+
+// ServiceAccountUserId returns the id of the service account user of the
+// client with the given clientId
+func (s *Server) ServiceAccountUserId(realmName string, clientId string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.realms[realmName].clientByClientId(clientId).serviceAccountUserId
+}
+
+func (s *Server) newId() string {
+	s.nextId++
+	return fmt.Sprintf("00000000-0000-0000-0000-%012d", s.nextId)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, req.Method+" "+req.URL.Path)
+	s.inFlight++
+	if s.inFlight > s.peak {
+		s.peak = s.inFlight
+	}
+	fault := s.matchFault(req)
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+
+	if fault != nil {
+		time.Sleep(fault.Delay)
+		if fault.Status != 0 {
+			if fault.RetryAfter != "" {
+				w.Header().Set("Retry-After", fault.RetryAfter)
+			}
+			writeError(w, fault.Status, "injected fault")
+			return
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := strings.Trim(req.URL.Path, "/")
+	segments := strings.Split(path, "/")
+
+	switch {
+	case len(segments) == 5 && segments[0] == "realms" && strings.Join(segments[2:], "/") == "protocol/openid-connect/token":
+		s.serveToken(w, req, segments[1])
+	case len(segments) >= 3 && segments[0] == "admin" && segments[1] == "realms":
+		if !s.authorized(req) {
+			writeError(w, http.StatusUnauthorized, "HTTP 401 Unauthorized")
+			return
+		}
+		r := s.realms[segments[2]]
+		if r == nil {
+			writeError(w, http.StatusNotFound, "Realm not found.")
+			return
+		}
+		s.serveAdmin(w, req, r, segments[3:])
+	default:
+		writeError(w, http.StatusNotFound, "Unable to find matching target resource method")
+	}
+}
+
+func (s *Server) matchFault(req *http.Request) *Fault {
+	for i, fault := range s.faults {
+		if fault.Method != "" && fault.Method != req.Method {
+			continue
+		}
+		if !fault.path.MatchString(req.URL.Path) {
+			continue
+		}
+		if fault.Times > 0 {
+			fault.Times--
+			if fault.Times == 0 {
+				s.faults = append(s.faults[:i:i], s.faults[i+1:]...)
+			}
+		}
+		return fault
+	}
+
+	return nil
+}
+
+func (s *Server) authorized(req *http.Request) bool {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	expiry, ok := s.tokens[token]
+
+	return ok && time.Now().Before(expiry)
+}
+
+func (s *Server) serveToken(w http.ResponseWriter, req *http.Request, realmName string) {
+	if s.realms[realmName] == nil {
+		writeError(w, http.StatusNotFound, "Realm does not exist")
+		return
+	}
+	if err := req.ParseForm(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	clientId, clientSecret, ok := req.BasicAuth()
+	if !ok {
+		clientId = req.PostForm.Get("client_id")
+		clientSecret = req.PostForm.Get("client_secret")
+	}
+
+	switch req.PostForm.Get("grant_type") {
+	case "client_credentials":
+		if clientId != s.ClientId || clientSecret != s.ClientSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized_client", "error_description": "Invalid client secret"})
+			return
+		}
+	case "password":
+		if req.PostForm.Get("username") != s.Username || req.PostForm.Get("password") != s.Password {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_grant", "error_description": "Invalid user credentials"})
+			return
+		}
+	case "refresh_token":
+		if _, ok := s.tokens[req.PostForm.Get("refresh_token")]; !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "Invalid refresh token"})
+			return
+		}
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	accessToken := "access-" + s.newId()
+	refreshToken := "refresh-" + s.newId()
+	s.tokens[accessToken] = time.Now().Add(s.TokenLifetime)
+	s.tokens[refreshToken] = time.Now().Add(2 * s.TokenLifetime)
+
+	writeJSON(w, http.StatusOK, gocloak.JWT{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		ExpiresIn:        int(s.TokenLifetime / time.Second),
+		RefreshExpiresIn: int(2 * s.TokenLifetime / time.Second),
+		TokenType:        "Bearer",
+	})
+}
+
+func (s *Server) serveAdmin(w http.ResponseWriter, req *http.Request, r *realm, segments []string) {
+	if len(segments) == 0 {
+		writeError(w, http.StatusNotFound, "Unable to find matching target resource method")
+		return
+	}
+
+	switch segments[0] {
+	case "clients":
+		s.serveClients(w, req, r, segments[1:])
+	case "roles":
+		s.serveRoles(w, req, r, "", segments[1:])
+	case "roles-by-id":
+		s.serveRolesById(w, req, r, segments[1:])
+	case "users":
+		s.serveUsers(w, req, r, segments[1:])
+	case "groups":
+		s.serveGroups(w, req, r, segments[1:])
+	default:
+		writeError(w, http.StatusNotFound, "Unable to find matching target resource method")
+	}
+}
+
+func (s *Server) serveClients(w http.ResponseWriter, req *http.Request, r *realm, segments []string) {
+	if len(segments) == 0 {
+		clients := []*gocloak.Client{}
+		for _, c := range r.sortedClients() {
+			if clientId := req.URL.Query().Get("clientId"); clientId == "" || clientId == c.clientId {
+				clients = append(clients, c.representation())
+			}
+		}
+		writeJSON(w, http.StatusOK, clients)
+		return
+	}
+
+	c := r.clients[segments[0]]
+	if c == nil {
+		writeError(w, http.StatusNotFound, "Could not find client")
+		return
+	}
+
+	switch {
+	case len(segments) == 1 && req.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, c.representation())
+	case len(segments) == 2 && segments[1] == "service-account-user" && req.Method == http.MethodGet:
+		if c.serviceAccountUserId == "" {
+			writeError(w, http.StatusBadRequest, "Service account not enabled for the client")
+			return
+		}
+		writeJSON(w, http.StatusOK, r.users[c.serviceAccountUserId].representation())
+	case len(segments) >= 2 && segments[1] == "roles":
+		s.serveRoles(w, req, r, c.id, segments[2:])
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "HTTP 405 Method Not Allowed")
+	}
+}
+
+// serveRoles handles the realm roles when clientId is empty, otherwise the
+// roles of that client
+func (s *Server) serveRoles(w http.ResponseWriter, req *http.Request, r *realm, clientId string, segments []string) {
+	if len(segments) == 0 {
+		switch req.Method {
+		case http.MethodGet:
+			roles := []*gocloak.Role{}
+			for _, rl := range r.sortedRoles() {
+				if rl.clientId == clientId {
+					roles = append(roles, rl.representation())
+				}
+			}
+			writeJSON(w, http.StatusOK, roles)
+		case http.MethodPost:
+			var body gocloak.Role
+			if !readJSON(w, req, &body) {
+				return
+			}
+			name := gocloak.PString(body.Name)
+			if r.roleByName(clientId, name) != nil {
+				writeError(w, http.StatusConflict, fmt.Sprintf("Role with name %s already exists", name))
+				return
+			}
+			rl := &role{id: s.newId(), clientId: clientId, composites: map[string]bool{}}
+			rl.update(body)
+			r.roles[rl.id] = rl
+			w.Header().Set("Location", fmt.Sprintf("%s%s/%s", s.URL, req.URL.Path, name))
+			w.WriteHeader(http.StatusCreated)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "HTTP 405 Method Not Allowed")
+		}
+		return
+	}
+
+	rl := r.roleByName(clientId, segments[0])
+	if rl == nil {
+		writeError(w, http.StatusNotFound, "Could not find role")
+		return
+	}
+
+	if len(segments) == 1 {
+		s.serveRole(w, req, r, rl)
+		return
+	}
+	if len(segments) == 2 && segments[1] == "composites" {
+		s.serveComposites(w, req, r, rl)
+		return
+	}
+	if len(segments) == 2 && segments[1] == "users" && req.Method == http.MethodGet {
+		users := []*gocloak.User{}
+		for _, u := range r.sortedUsers() {
+			if u.roles[rl.id] {
+				users = append(users, u.representation())
+			}
+		}
+		writeJSON(w, http.StatusOK, paged(req, users))
+		return
+	}
+	if len(segments) == 2 && segments[1] == "groups" && req.Method == http.MethodGet {
+		groups := []*gocloak.Group{}
+		for _, g := range r.sortedGroups() {
+			if g.roles[rl.id] {
+				groups = append(groups, g.representation())
+			}
+		}
+		writeJSON(w, http.StatusOK, paged(req, groups))
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "Unable to find matching target resource method")
+}
+
+func (s *Server) serveRolesById(w http.ResponseWriter, req *http.Request, r *realm, segments []string) {
+	if len(segments) == 0 {
+		writeError(w, http.StatusNotFound, "Unable to find matching target resource method")
+		return
+	}
+
+	rl := r.roles[segments[0]]
+	if rl == nil {
+		writeError(w, http.StatusNotFound, "Could not find role")
+		return
+	}
+
+	if len(segments) == 1 {
+		s.serveRole(w, req, r, rl)
+		return
+	}
+	if len(segments) == 2 && segments[1] == "composites" {
+		s.serveComposites(w, req, r, rl)
+		return
+	}
+
+	writeError(w, http.StatusNotFound, "Unable to find matching target resource method")
+}
+
+func (s *Server) serveRole(w http.ResponseWriter, req *http.Request, r *realm, rl *role) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, rl.representation())
+	case http.MethodPut:
+		var body gocloak.Role
+		if !readJSON(w, req, &body) {
+			return
+		}
+		if name := gocloak.PString(body.Name); name != "" && name != rl.name && r.roleByName(rl.clientId, name) != nil {
+			writeError(w, http.StatusConflict, fmt.Sprintf("Role with name %s already exists", name))
+			return
+		}
+		rl.update(body)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		r.deleteRole(rl)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "HTTP 405 Method Not Allowed")
+	}
+}
+
+func (s *Server) serveComposites(w http.ResponseWriter, req *http.Request, r *realm, rl *role) {
+	if req.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, r.compositesOf(rl))
+		return
+	}
+
+	var body []gocloak.Role
+	if !readJSON(w, req, &body) {
+		return
+	}
+
+	for _, composite := range body {
+		id := gocloak.PString(composite.ID)
+		if r.roles[id] == nil {
+			writeError(w, http.StatusNotFound, "Could not find composite role")
+			return
+		}
+	}
+
+	for _, composite := range body {
+		switch req.Method {
+		case http.MethodPost:
+			rl.composites[*composite.ID] = true
+		case http.MethodDelete:
+			delete(rl.composites, *composite.ID)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "HTTP 405 Method Not Allowed")
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) serveUsers(w http.ResponseWriter, req *http.Request, r *realm, segments []string) {
+	if len(segments) == 0 {
+		writeError(w, http.StatusNotFound, "Unable to find matching target resource method")
+		return
+	}
+
+	u := r.users[segments[0]]
+	if u == nil {
+		writeError(w, http.StatusNotFound, "User not found")
+		return
+	}
+	if len(segments) > 1 {
+		s.serveRoleMappings(w, req, r, u.roles, segments[1:])
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, u.representation())
+	case http.MethodPut:
+		var body gocloak.User
+		if !readJSON(w, req, &body) {
+			return
+		}
+		if body.FirstName != nil {
+			u.firstName = *body.FirstName
+		}
+		if body.LastName != nil {
+			u.lastName = *body.LastName
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "HTTP 405 Method Not Allowed")
+	}
+}
+
+func (s *Server) serveGroups(w http.ResponseWriter, req *http.Request, r *realm, segments []string) {
+	if len(segments) < 2 {
+		writeError(w, http.StatusNotFound, "Unable to find matching target resource method")
+		return
+	}
+
+	g := r.groups[segments[0]]
+	if g == nil {
+		writeError(w, http.StatusNotFound, "Could not find group by id")
+		return
+	}
+	s.serveRoleMappings(w, req, r, g.roles, segments[1:])
+}
+
+// serveRoleMappings adds realm roles, or roles of the client given after
+// clients, to the mappings of a user or group
+func (s *Server) serveRoleMappings(w http.ResponseWriter, req *http.Request, r *realm, mappings map[string]bool, segments []string) {
+	clientId := ""
+	switch {
+	case len(segments) == 2 && segments[0] == "role-mappings" && segments[1] == "realm":
+	case len(segments) == 3 && segments[0] == "role-mappings" && segments[1] == "clients" && r.clients[segments[2]] != nil:
+		clientId = segments[2]
+	default:
+		writeError(w, http.StatusNotFound, "Unable to find matching target resource method")
+		return
+	}
+	if req.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "HTTP 405 Method Not Allowed")
+		return
+	}
+
+	var body []gocloak.Role
+	if !readJSON(w, req, &body) {
+		return
+	}
+	for _, mapped := range body {
+		if rl := r.roles[gocloak.PString(mapped.ID)]; rl == nil || rl.clientId != clientId {
+			writeError(w, http.StatusNotFound, "Could not find role")
+			return
+		}
+	}
+	for _, mapped := range body {
+		mappings[*mapped.ID] = true
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// paged applies the first and max query parameters, keycloak returns 100
+// entries when max is not given
+func paged[T any](req *http.Request, list []T) []T {
+	first, max := 0, 100
+	if v, err := strconv.Atoi(req.URL.Query().Get("first")); err == nil {
+		first = v
+	}
+	if v, err := strconv.Atoi(req.URL.Query().Get("max")); err == nil {
+		max = v
+	}
+
+	if first > len(list) {
+		first = len(list)
+	}
+	if first+max < len(list) {
+		return list[first : first+max]
+	}
+	return list[first:]
+}
+
+func (r *realm) clientByClientId(clientId string) *client {
+	for _, c := range r.clients {
+		if c.clientId == clientId {
+			return c
+		}
+	}
+	return nil
+}
+
+func (r *realm) roleByName(clientId string, name string) *role {
+	for _, rl := range r.roles {
+		if rl.clientId == clientId && rl.name == name {
+			return rl
+		}
+	}
+	return nil
+}
+
+func (r *realm) deleteRole(rl *role) {
+	delete(r.roles, rl.id)
+	for _, other := range r.roles {
+		delete(other.composites, rl.id)
+	}
+	for _, u := range r.users {
+		delete(u.roles, rl.id)
+	}
+	for _, g := range r.groups {
+		delete(g.roles, rl.id)
+	}
+}
+
+// holderRoles returns the role mappings of the user or group with the given id
+func (r *realm) holderRoles(id string) map[string]bool {
+	if u := r.users[id]; u != nil {
+		return u.roles
+	}
+	return r.groups[id].roles
+}
+
+func (r *realm) compositesOf(rl *role) []*gocloak.Role {
+	composites := []*gocloak.Role{}
+	for _, other := range r.sortedRoles() {
+		if rl.composites[other.id] {
+			composites = append(composites, other.representation())
+		}
+	}
+	return composites
+}
+
+func (r *realm) sortedRoles() []*role {
+	roles := make([]*role, 0, len(r.roles))
+	for _, rl := range r.roles {
+		roles = append(roles, rl)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].id < roles[j].id })
+	return roles
+}
+
+func (r *realm) sortedUsers() []*user {
+	users := make([]*user, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].id < users[j].id })
+	return users
+}
+
+func (r *realm) sortedGroups() []*group {
+	groups := make([]*group, 0, len(r.groups))
+	for _, g := range r.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].id < groups[j].id })
+	return groups
+}
+
+func (r *realm) sortedClients() []*client {
+	clients := make([]*client, 0, len(r.clients))
+	for _, c := range r.clients {
+		clients = append(clients, c)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].id < clients[j].id })
+	return clients
+}
+
+func (rl *role) update(body gocloak.Role) {
+	if body.Name != nil {
+		rl.name = *body.Name
+	}
+	rl.description = gocloak.PString(body.Description)
+	rl.attributes = map[string][]string{}
+	if body.Attributes != nil {
+		for k, v := range *body.Attributes {
+			rl.attributes[k] = v
+		}
+	}
+}
+
+func (rl *role) representation() *gocloak.Role {
+	attributes := map[string][]string{}
+	for k, v := range rl.attributes {
+		attributes[k] = v
+	}
+
+	return &gocloak.Role{
+		ID:          gocloak.StringP(rl.id),
+		Name:        gocloak.StringP(rl.name),
+		Description: gocloak.StringP(rl.description),
+		Attributes:  &attributes,
+		Composite:   gocloak.BoolP(len(rl.composites) > 0),
+		ClientRole:  gocloak.BoolP(rl.clientId != ""),
+		ContainerID: gocloak.StringP(rl.clientId),
+	}
+}
+
+func (c *client) representation() *gocloak.Client {
+	return &gocloak.Client{
+		ID:                     gocloak.StringP(c.id),
+		ClientID:               gocloak.StringP(c.clientId),
+		ServiceAccountsEnabled: gocloak.BoolP(c.serviceAccountUserId != ""),
+	}
+}
+
+func (u *user) representation() *gocloak.User {
+	return &gocloak.User{
+		ID:        gocloak.StringP(u.id),
+		Username:  gocloak.StringP(u.username),
+		FirstName: gocloak.StringP(u.firstName),
+		LastName:  gocloak.StringP(u.lastName),
+	}
+}
+
+func (g *group) representation() *gocloak.Group {
+	return &gocloak.Group{
+		ID:   gocloak.StringP(g.id),
+		Name: gocloak.StringP(g.name),
+		Path: gocloak.StringP("/" + g.name),
+	}
+}
+
+func readJSON(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	if err := json.NewDecoder(req.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
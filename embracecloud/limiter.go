@@ -0,0 +1,78 @@
+package embracecloud
+
+import (
+	"io"
+	"net/http"
+	"sync"
+
+	"golang.org/x/time/rate"
+)
+
+// limitedTransport holds requests to keycloak back until a concurrency slot
+// is free and the rate limit allows another request. Every gocloak call and
+// each of its retries passes through it.
+type limitedTransport struct {
+	next    http.RoundTripper
+	slots   chan struct{}
+	limiter *rate.Limiter
+}
+
+// newLimitedTransport wraps next, a zero maxConcurrent or requestsPerSecond
+// leaves that limit off
+func newLimitedTransport(next http.RoundTripper, maxConcurrent int, requestsPerSecond float64) http.RoundTripper {
+	if maxConcurrent <= 0 && requestsPerSecond <= 0 {
+		return next
+	}
+
+	transport := &limitedTransport{next: next}
+	if maxConcurrent > 0 {
+		transport.slots = make(chan struct{}, maxConcurrent)
+	}
+	if requestsPerSecond > 0 {
+		transport.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), 1)
+	}
+
+	return transport
+}
+
+func (t *limitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	if t.limiter != nil {
+		if err := t.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	if t.slots == nil {
+		return t.next.RoundTrip(req)
+	}
+
+	select {
+	case t.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		<-t.slots
+		return nil, err
+	}
+
+	// the slot is held until the body is read and closed
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: func() { <-t.slots }}
+	return resp, nil
+}
+
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
@@ -0,0 +1,108 @@
+package embracecloud
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Nerzal/gocloak/v12"
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+)
+
+// testParallelGetClients lists the clients of the master realm from n
+// goroutines at once
+func testParallelGetClients(t *testing.T, client *EmbraceCloudClient, n int) {
+	t.Helper()
+
+	api, err := client.GetKeycloakClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = api.GetClients(context.Background(), "master", gocloak.GetClientsParams{})
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMaxConcurrentRequests(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	server.InjectFault(keycloaktest.Fault{Method: http.MethodGet, Path: "/clients$", Delay: 50 * time.Millisecond})
+	config := testConfig(server)
+	config.MaxConcurrentRequests = 2
+
+	testParallelGetClients(t, testClient(config), 8)
+	if peak := server.PeakConcurrentRequests(); peak != 2 {
+		t.Errorf("expected 2 requests in flight at most, got %d", peak)
+	}
+}
+
+func TestUnlimitedConcurrentRequests(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	server.InjectFault(keycloaktest.Fault{Method: http.MethodGet, Path: "/clients$", Delay: 50 * time.Millisecond})
+
+	testParallelGetClients(t, testClient(testConfig(server)), 8)
+	if peak := server.PeakConcurrentRequests(); peak < 3 {
+		t.Errorf("expected more than 2 requests in flight without a limit, got %d", peak)
+	}
+}
+
+func TestRequestsPerSecond(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	config := testConfig(server)
+	config.RequestsPerSecond = 20
+	client := testClient(config)
+
+	// the login takes the first request of the budget
+	started := time.Now()
+	testParallelGetClients(t, client, 9)
+
+	if elapsed := time.Since(started); elapsed < 400*time.Millisecond {
+		t.Errorf("expected 10 requests at 20 per second to take about 450ms, took %s", elapsed)
+	}
+}
+
+func TestQueuedRequestsDoNotTimeOut(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	server.InjectFault(keycloaktest.Fault{Method: http.MethodGet, Path: "/clients$", Delay: 100 * time.Millisecond})
+	config := testConfig(server)
+	config.MaxConcurrentRequests = 1
+	config.Timeout = 250 * time.Millisecond
+
+	// the last request waits about 300ms for its slot, longer than the timeout
+	testParallelGetClients(t, testClient(config), 4)
+	if requests := server.RequestCount(http.MethodGet, "/clients$"); requests != 4 {
+		t.Errorf("expected every request to be sent once, got %d requests", requests)
+	}
+}
+
+func TestSlowRequestTimesOut(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	server.InjectFault(keycloaktest.Fault{Method: http.MethodGet, Path: "/clients$", Delay: 300 * time.Millisecond})
+	config := testConfig(server)
+	config.MaxConcurrentRequests = 1
+	config.Timeout = 100 * time.Millisecond
+	client := testClient(config)
+
+	api, err := client.GetKeycloakClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.GetClients(context.Background(), "master", gocloak.GetClientsParams{}); err == nil {
+		t.Error("expected the slow request to time out")
+	}
+}
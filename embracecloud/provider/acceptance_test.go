@@ -0,0 +1,471 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v12"
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/acctest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+// The acceptance tests run when TF_ACC is set. They use the keycloak given by
+// the provider environment variables, EMBRACECLOUD_ACC_REALM and
+// EMBRACECLOUD_ACC_CLIENT_ID name an existing realm and client to work in.
+// Without EMBRACECLOUD_KEYCLOACK_URL they fall back to the fake keycloak.
+// All checks go through the admin api, so they hold for both.
+
+// testAccTarget is the keycloak an acceptance test runs against
+type testAccTarget struct {
+	url          string
+	authRealm    string
+	clientId     string
+	clientSecret string
+	realm        string
+	client       string
+	api          embracecloud.KeycloakAPI
+}
+
+func testAccKeycloakTarget(t *testing.T) *testAccTarget {
+	if os.Getenv(resource.EnvTfAcc) == "" {
+		t.Skipf("acceptance tests are skipped unless %s is set", resource.EnvTfAcc)
+	}
+	testAccPreCheckTerraform(t)
+
+	target := &testAccTarget{
+		url:          os.Getenv("EMBRACECLOUD_KEYCLOACK_URL"),
+		authRealm:    testAccEnv("EMBRACECLOUD_KEYCLOACK_REALM", "master"),
+		clientId:     os.Getenv("EMBRACECLOUD_KEYCLOACK_CLIENT_ID"),
+		clientSecret: os.Getenv("EMBRACECLOUD_KEYCLOACK_CLIENT_SECRET"),
+		realm:        testAccEnv("EMBRACECLOUD_ACC_REALM", testRealm),
+		client:       testAccEnv("EMBRACECLOUD_ACC_CLIENT_ID", testClientId),
+	}
+
+	if target.url == "" {
+		server := testKeycloak(t)
+		target.url = server.URL
+		target.authRealm = "master"
+		target.clientId = server.ClientId
+		target.clientSecret = server.ClientSecret
+		target.realm = testRealm
+		target.client = testClientId
+	}
+
+	client := embracecloud.BuildClient()
+	client.ConfigureKeycloak(embracecloud.KeycloakConfig{
+		Url:          target.url,
+		Realm:        target.authRealm,
+		ClientId:     target.clientId,
+		ClientSecret: target.clientSecret,
+	})
+
+	api, err := client.GetKeycloakClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	target.api = api
+
+	return target
+}
+
+func testAccEnv(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func (target *testAccTarget) providerConfig() string {
+	return fmt.Sprintf(`
+provider "embracecloud" {
+  keycloak_enabled       = true
+  keycloak_url           = %q
+  keycloak_realm         = %q
+  keycloak_client_id     = %q
+  keycloak_client_secret = %q
+}
+`, target.url, target.authRealm, target.clientId, target.clientSecret)
+}
+
+func (target *testAccTarget) clientUuid() (string, error) {
+	clients, err := target.api.GetClients(context.Background(), target.realm, gocloak.GetClientsParams{ClientID: &target.client})
+	if err != nil {
+		return "", err
+	}
+	if len(clients) != 1 {
+		return "", fmt.Errorf("expected one client %s in realm %s, found %d", target.client, target.realm, len(clients))
+	}
+	return *clients[0].ID, nil
+}
+
+func (target *testAccTarget) checkRealmRole(name string, description string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		role, err := target.api.GetRealmRole(context.Background(), target.realm, name)
+		if err != nil {
+			return err
+		}
+		if gocloak.PString(role.Description) != description {
+			return fmt.Errorf("expected description %q of realm role %s, got %q", description, name, gocloak.PString(role.Description))
+		}
+		return nil
+	}
+}
+
+func (target *testAccTarget) checkClientRole(name string, description string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		clientUuid, err := target.clientUuid()
+		if err != nil {
+			return err
+		}
+		role, err := target.api.GetClientRole(context.Background(), target.realm, clientUuid, name)
+		if err != nil {
+			return err
+		}
+		if gocloak.PString(role.Description) != description {
+			return fmt.Errorf("expected description %q of client role %s, got %q", description, name, gocloak.PString(role.Description))
+		}
+		return nil
+	}
+}
+
+func (target *testAccTarget) checkComposite(parent string, child string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		role, err := target.api.GetRealmRole(context.Background(), target.realm, parent)
+		if err != nil {
+			return err
+		}
+		composites, err := target.api.GetCompositeRolesByRoleID(context.Background(), target.realm, *role.ID)
+		if err != nil {
+			return err
+		}
+		for _, composite := range composites {
+			if gocloak.PString(composite.Name) == child {
+				return nil
+			}
+		}
+		return fmt.Errorf("realm role %s has no composite %s", parent, child)
+	}
+}
+
+// checkDestroy verifies the roles of the state are gone from keycloak and
+// that the parent roles left behind have none of the composites of the state
+func (target *testAccTarget) checkDestroy(s *terraform.State) error {
+	for _, rs := range s.RootModule().Resources {
+		var err error
+		switch rs.Type {
+		case "embracecloud_realm_role":
+			_, err = target.api.GetRealmRole(context.Background(), target.realm, rs.Primary.ID)
+		case "embracecloud_client_role":
+			var clientUuid string
+			clientUuid, err = target.clientUuid()
+			if err == nil {
+				_, err = target.api.GetClientRole(context.Background(), target.realm, clientUuid, rs.Primary.ID)
+			}
+		case "embracecloud_realm_role_composite", "embracecloud_client_role_composite":
+			err = target.checkCompositeDestroyed(rs.Primary.ID)
+		case "embracecloud_role_composites":
+			err = target.checkRoleCompositesDestroyed(rs.Primary.Attributes["client_id"], rs.Primary.Attributes["parent_role_name"])
+		default:
+			continue
+		}
+
+		var apiErr *gocloak.APIError
+		if err == nil {
+			return fmt.Errorf("%s %s still exists", rs.Type, rs.Primary.ID)
+		}
+		if !errors.As(err, &apiErr) || apiErr.Code != http.StatusNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkCompositeDestroyed returns a not found error when the composite with
+// the given id is gone, because either role or the link between them is
+func (target *testAccTarget) checkCompositeDestroyed(id string) error {
+	_, parentClientId, parentRoleName, compositeClientId, compositeRoleName, err := parseCompositeId(id)
+	if err != nil {
+		return err
+	}
+	parent, err := getRole(context.Background(), target.api, target.realm, parentClientId, parentRoleName)
+	if err != nil {
+		return err
+	}
+	child, err := getRole(context.Background(), target.api, target.realm, compositeClientId, compositeRoleName)
+	if err != nil {
+		return err
+	}
+	composites, err := target.api.GetCompositeRolesByRoleID(context.Background(), target.realm, *parent.ID)
+	if err != nil {
+		return err
+	}
+	for _, composite := range composites {
+		if *composite.ID == *child.ID {
+			return nil
+		}
+	}
+	return &gocloak.APIError{Code: http.StatusNotFound, Message: fmt.Sprintf("role %s has no composite %s", parentRoleName, compositeRoleName)}
+}
+
+// checkRoleCompositesDestroyed returns a not found error when the parent role
+// is gone or has no composites left
+func (target *testAccTarget) checkRoleCompositesDestroyed(clientId string, parentRoleName string) error {
+	parent, err := getRole(context.Background(), target.api, target.realm, clientId, parentRoleName)
+	if err != nil {
+		return err
+	}
+	composites, err := target.api.GetCompositeRolesByRoleID(context.Background(), target.realm, *parent.ID)
+	if err != nil {
+		return err
+	}
+	if len(composites) > 0 {
+		return nil
+	}
+	return &gocloak.APIError{Code: http.StatusNotFound, Message: fmt.Sprintf("role %s has no composites", parentRoleName)}
+}
+
+func TestAccRealmRole_changeDescription(t *testing.T) {
+	target := testAccKeycloakTarget(t)
+	name := acctest.RandomWithPrefix("tf-acc")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      target.checkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: target.providerConfig() + target.realmRoleConfig(name, "first description"),
+				Check:  target.checkRealmRole(name, "first description"),
+			},
+			{
+				Config: target.providerConfig() + target.realmRoleConfig(name, "second description"),
+				Check:  target.checkRealmRole(name, "second description"),
+			},
+		},
+	})
+}
+
+func TestAccRealmRole_deletedOutsideTerraform(t *testing.T) {
+	target := testAccKeycloakTarget(t)
+	name := acctest.RandomWithPrefix("tf-acc")
+	config := target.providerConfig() + target.realmRoleConfig(name, "description")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      target.checkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check:  target.checkRealmRole(name, "description"),
+			},
+			{
+				PreConfig: func() {
+					if err := target.api.DeleteRealmRole(context.Background(), target.realm, name); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config,
+				Check:  target.checkRealmRole(name, "description"),
+			},
+		},
+	})
+}
+
+func TestAccClientRole_changeDescription(t *testing.T) {
+	target := testAccKeycloakTarget(t)
+	name := acctest.RandomWithPrefix("tf-acc")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      target.checkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: target.providerConfig() + target.clientRoleConfig(name, "first description"),
+				Check:  target.checkClientRole(name, "first description"),
+			},
+			{
+				Config: target.providerConfig() + target.clientRoleConfig(name, "second description"),
+				Check:  target.checkClientRole(name, "second description"),
+			},
+		},
+	})
+}
+
+func TestAccClientRole_import(t *testing.T) {
+	target := testAccKeycloakTarget(t)
+	name := acctest.RandomWithPrefix("tf-acc")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      target.checkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: target.providerConfig() + target.clientRoleConfig(name, "description"),
+			},
+			{
+				ResourceName:      "embracecloud_client_role.role",
+				ImportState:       true,
+				ImportStateId:     target.realm + "/" + target.client + "/" + name,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestAccRealmRoleComposite_childDeletedOutsideTerraform(t *testing.T) {
+	target := testAccKeycloakTarget(t)
+	parent := acctest.RandomWithPrefix("tf-acc")
+	child := acctest.RandomWithPrefix("tf-acc")
+	config := target.providerConfig() + target.realmRoleCompositeConfig(parent, child)
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      target.checkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check:  target.checkComposite(parent, child),
+			},
+			{
+				PreConfig: func() {
+					if err := target.api.DeleteRealmRole(context.Background(), target.realm, child); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config,
+				Check:  target.checkComposite(parent, child),
+			},
+		},
+	})
+}
+
+func TestAccRealmRoleComposite_removedOutsideTerraform(t *testing.T) {
+	target := testAccKeycloakTarget(t)
+	parent := acctest.RandomWithPrefix("tf-acc")
+	child := acctest.RandomWithPrefix("tf-acc")
+	config := target.providerConfig() + target.realmRoleCompositeConfig(parent, child)
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      target.checkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check:  target.checkComposite(parent, child),
+			},
+			{
+				PreConfig: func() {
+					role, err := target.api.GetRealmRole(context.Background(), target.realm, child)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if err := target.api.DeleteRealmRoleComposite(context.Background(), target.realm, parent, []gocloak.Role{*role}); err != nil {
+						t.Fatal(err)
+					}
+				},
+				Config: config,
+				Check:  target.checkComposite(parent, child),
+			},
+		},
+	})
+}
+
+func TestAccRealmRoleComposite_import(t *testing.T) {
+	target := testAccKeycloakTarget(t)
+	parent := acctest.RandomWithPrefix("tf-acc")
+	child := acctest.RandomWithPrefix("tf-acc")
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      target.checkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: target.providerConfig() + target.realmRoleCompositeConfig(parent, child),
+			},
+			{
+				ResourceName:      "embracecloud_realm_role_composite.composite",
+				ImportState:       true,
+				ImportStateId:     fmt.Sprintf("%s//%s//%s", target.realm, parent, child),
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestAccRoleComposites_rolesKept(t *testing.T) {
+	target := testAccKeycloakTarget(t)
+	parent := acctest.RandomWithPrefix("tf-acc")
+	child := acctest.RandomWithPrefix("tf-acc")
+
+	// the roles are not managed here, so destroying only removes the link
+	for _, name := range []string{parent, child} {
+		name := name
+		if _, err := target.api.CreateRealmRole(context.Background(), target.realm, gocloak.Role{Name: &name}); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = target.api.DeleteRealmRole(context.Background(), target.realm, name) })
+	}
+
+	resource.Test(t, resource.TestCase{
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      target.checkDestroy,
+		Steps: []resource.TestStep{
+			{
+				Config: target.providerConfig() + fmt.Sprintf(`
+resource "embracecloud_role_composites" "composites" {
+  realm_id         = %q
+  parent_role_name = %q
+  realm_roles      = [%q]
+}
+`, target.realm, parent, child),
+				Check: target.checkComposite(parent, child),
+			},
+		},
+	})
+}
+
+func (target *testAccTarget) realmRoleConfig(name string, description string) string {
+	return fmt.Sprintf(`
+resource "embracecloud_realm_role" "role" {
+  realm_id    = %q
+  name        = %q
+  description = %q
+}
+`, target.realm, name, description)
+}
+
+func (target *testAccTarget) clientRoleConfig(name string, description string) string {
+	return fmt.Sprintf(`
+resource "embracecloud_client_role" "role" {
+  realm_id    = %q
+  client_id   = %q
+  name        = %q
+  description = %q
+}
+`, target.realm, target.client, name, description)
+}
+
+func (target *testAccTarget) realmRoleCompositeConfig(parent string, child string) string {
+	return fmt.Sprintf(`
+resource "embracecloud_realm_role" "parent" {
+  realm_id = %[1]q
+  name     = %[2]q
+}
+
+resource "embracecloud_realm_role" "child" {
+  realm_id = %[1]q
+  name     = %[3]q
+}
+
+resource "embracecloud_realm_role_composite" "composite" {
+  realm_id            = %[1]q
+  parent_role_name    = embracecloud_realm_role.parent.name
+  composite_role_name = embracecloud_realm_role.child.name
+}
+`, target.realm, parent, child)
+}
@@ -0,0 +1,57 @@
+package provider
+
+import (
+	"context"
+
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceKeycloakClientRole() *schema.Resource {
+	dataSourceSchema := map[string]*schema.Schema{
+		"realm_id": {
+			Type:     schema.TypeString,
+			Required: true,
+		},
+		"client_id": {
+			Type:     schema.TypeString,
+			Required: true,
+		},
+		"name": {
+			Type:     schema.TypeString,
+			Required: true,
+		},
+	}
+	for key, value := range dataSourceRoleSchema() {
+		dataSourceSchema[key] = value
+	}
+
+	return &schema.Resource{
+		ReadContext: dataSourceKeycloakClientRoleRead,
+		Schema:      dataSourceSchema,
+	}
+}
+
+func dataSourceKeycloakClientRoleRead(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	realm := data.Get("realm_id").(string)
+	clientId := data.Get("client_id").(string)
+	name := data.Get("name").(string)
+
+	role, err := getRole(ctx, keycloakCLient, realm, clientId, name)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	data.SetId(*role.ID)
+
+	if err := setDataSourceRole(ctx, keycloakCLient, data, realm, role); err != nil {
+		return diag.Errorf("could not read client role %s in client %s in realm %s error -> %s", name, clientId, realm, err.Error())
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestDataSourceKeycloakClientRole_basic(t *testing.T) {
+	server := testKeycloak(t)
+	tenantAdmin := server.CreateClientRole(testRealm, testClientId, "tenant-admin")
+	tenantReader := server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	reader := server.CreateRealmRole(testRealm, "reader")
+	server.UpdateRole(testRealm, tenantAdmin, "administers tenants", map[string][]string{"tier": {"gold"}})
+	server.AddComposite(testRealm, tenantAdmin, tenantReader)
+	server.AddComposite(testRealm, tenantReader, reader)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+data "embracecloud_client_role" "role" {
+  realm_id          = %q
+  client_id         = %q
+  name              = "tenant-admin"
+  expand_composites = true
+}
+`, testRealm, testClientId),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.embracecloud_client_role.role", "id", tenantAdmin),
+					resource.TestCheckResourceAttr("data.embracecloud_client_role.role", "description", "administers tenants"),
+					resource.TestCheckTypeSetElemNestedAttrs("data.embracecloud_client_role.role", "attribute.*", map[string]string{"name": "tier", "values.0": "gold"}),
+					resource.TestCheckResourceAttr("data.embracecloud_client_role.role", "composite_realm_roles.#", "0"),
+					resource.TestCheckTypeSetElemNestedAttrs("data.embracecloud_client_role.role", "composite_client_roles.*", map[string]string{"client_id": testClientId, "role_name": "tenant-reader"}),
+					resource.TestCheckTypeSetElemAttr("data.embracecloud_client_role.role", "effective_realm_roles.*", "reader"),
+				),
+			},
+		},
+	})
+}
+
+func TestDataSourceKeycloakClientRole_unknownClient(t *testing.T) {
+	server := testKeycloak(t)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+data "embracecloud_client_role" "role" {
+  realm_id  = %q
+  client_id = "other-client"
+  name      = "tenant-admin"
+}
+`, testRealm),
+				ExpectError: regexp.MustCompile("client other-client not found in realm test"),
+			},
+		},
+	})
+}
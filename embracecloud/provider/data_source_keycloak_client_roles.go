@@ -0,0 +1,162 @@
+package provider
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v12"
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+func dataSourceKeycloakClientRoles() *schema.Resource {
+	return &schema.Resource{
+		ReadContext: dataSourceKeycloakClientRolesRead,
+		Schema: map[string]*schema.Schema{
+			"realm_id": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"client_id": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"name_prefix": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "only roles whose name starts with this",
+			},
+			"name_regex": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringIsValidRegExp,
+				Description:  "only roles whose name matches this regular expression",
+			},
+			"attribute_name": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Description: "only roles that have this attribute",
+			},
+			"attribute_value": {
+				Type:         schema.TypeString,
+				Optional:     true,
+				RequiredWith: []string{"attribute_name"},
+				Description:  "only roles whose attribute_name attribute has this among its values",
+			},
+			"names": {
+				Type:        schema.TypeList,
+				Computed:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "sorted names of the roles",
+			},
+			"roles": {
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Resource{
+					Schema: map[string]*schema.Schema{
+						"id": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"name": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"description": {
+							Type:     schema.TypeString,
+							Computed: true,
+						},
+						"attribute": dataSourceRoleSchema()["attribute"],
+					},
+				},
+			},
+		},
+	}
+}
+
+func dataSourceKeycloakClientRolesRead(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	realm := data.Get("realm_id").(string)
+	clientId := data.Get("client_id").(string)
+
+	idOfClient, err := keycloakCLient.GetClientUUID(ctx, realm, clientId)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// the brief representation leaves out the attributes
+	roles, err := keycloakCLient.GetClientRoles(ctx, realm, idOfClient, gocloak.GetRoleParams{
+		BriefRepresentation: gocloak.BoolP(false),
+	})
+	if err != nil {
+		return diag.Errorf("could not get roles of client %s in realm %s error -> %s", clientId, realm, err.Error())
+	}
+
+	var nameRegex *regexp.Regexp
+	if v, ok := data.GetOk("name_regex"); ok {
+		nameRegex = regexp.MustCompile(v.(string))
+	}
+	namePrefix := data.Get("name_prefix").(string)
+	attributeName := data.Get("attribute_name").(string)
+	attributeValue, filterValue := data.GetOk("attribute_value")
+
+	var matches []*gocloak.Role
+	for _, role := range roles {
+		name := gocloak.PString(role.Name)
+		if !strings.HasPrefix(name, namePrefix) {
+			continue
+		}
+		if nameRegex != nil && !nameRegex.MatchString(name) {
+			continue
+		}
+		if attributeName != "" {
+			var attributes map[string][]string
+			if role.Attributes != nil {
+				attributes = *role.Attributes
+			}
+			values, ok := attributes[attributeName]
+			if !ok || (filterValue && !containsString(values, attributeValue.(string))) {
+				continue
+			}
+		}
+		matches = append(matches, role)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return *matches[i].Name < *matches[j].Name
+	})
+
+	names := []string{}
+	result := []interface{}{}
+	for _, role := range matches {
+		names = append(names, *role.Name)
+		result = append(result, map[string]interface{}{
+			"id":          gocloak.PString(role.ID),
+			"name":        *role.Name,
+			"description": gocloak.PString(role.Description),
+			"attribute":   flattenRoleAttributes(role.Attributes),
+		})
+	}
+
+	data.SetId(realm + "/" + clientId)
+	data.Set("names", names)
+	data.Set("roles", result)
+
+	return nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestDataSourceKeycloakClientRoles_filters(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateClient(testRealm, "other-client")
+	server.CreateClientRole(testRealm, "other-client", "tenant-other")
+	server.CreateClientRole(testRealm, testClientId, "admin")
+	tenantWriter := server.CreateClientRole(testRealm, testClientId, "tenant-writer")
+	tenantReader := server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	server.UpdateRole(testRealm, tenantWriter, "", map[string][]string{"tier": {"silver", "gold"}})
+	server.UpdateRole(testRealm, tenantReader, "reads tenants", map[string][]string{"tier": {"gold"}})
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+data "embracecloud_client_roles" "all" {
+  realm_id  = %[1]q
+  client_id = %[2]q
+}
+
+data "embracecloud_client_roles" "prefix" {
+  realm_id    = %[1]q
+  client_id   = %[2]q
+  name_prefix = "tenant-"
+}
+
+data "embracecloud_client_roles" "regex" {
+  realm_id   = %[1]q
+  client_id  = %[2]q
+  name_regex = "^tenant-w"
+}
+
+data "embracecloud_client_roles" "attribute" {
+  realm_id        = %[1]q
+  client_id       = %[2]q
+  attribute_name  = "tier"
+  attribute_value = "silver"
+}
+`, testRealm, testClientId),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.embracecloud_client_roles.all", "names.#", "3"),
+					resource.TestCheckResourceAttr("data.embracecloud_client_roles.all", "names.0", "admin"),
+
+					resource.TestCheckResourceAttr("data.embracecloud_client_roles.prefix", "names.#", "2"),
+					resource.TestCheckResourceAttr("data.embracecloud_client_roles.prefix", "names.0", "tenant-reader"),
+					resource.TestCheckResourceAttr("data.embracecloud_client_roles.prefix", "names.1", "tenant-writer"),
+					resource.TestCheckResourceAttr("data.embracecloud_client_roles.prefix", "roles.0.id", tenantReader),
+					resource.TestCheckResourceAttr("data.embracecloud_client_roles.prefix", "roles.0.description", "reads tenants"),
+
+					resource.TestCheckResourceAttr("data.embracecloud_client_roles.regex", "names.#", "1"),
+					resource.TestCheckResourceAttr("data.embracecloud_client_roles.regex", "names.0", "tenant-writer"),
+
+					resource.TestCheckResourceAttr("data.embracecloud_client_roles.attribute", "names.#", "1"),
+					resource.TestCheckResourceAttr("data.embracecloud_client_roles.attribute", "names.0", "tenant-writer"),
+				),
+			},
+		},
+	})
+}
+
+func TestDataSourceKeycloakClientRoles_grantToComposite(t *testing.T) {
+	server := testKeycloak(t)
+	admin := server.CreateRealmRole(testRealm, "admin")
+	server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	server.CreateClientRole(testRealm, testClientId, "tenant-writer")
+	server.CreateClientRole(testRealm, testClientId, "internal")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckCompositesDestroy(server, admin),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+data "embracecloud_client_roles" "tenant" {
+  realm_id    = %[1]q
+  client_id   = %[2]q
+  name_prefix = "tenant-"
+}
+
+resource "embracecloud_role_composites" "admin" {
+  realm_id         = %[1]q
+  parent_role_name = "admin"
+
+  dynamic "client_roles" {
+    for_each = data.embracecloud_client_roles.tenant.names
+    content {
+      client_id = %[2]q
+      role_name = client_roles.value
+    }
+  }
+}
+`, testRealm, testClientId),
+				Check: testAccCheckComposites(server, admin, "tenant-reader", "tenant-writer"),
+			},
+		},
+	})
+}
@@ -0,0 +1,189 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Nerzal/gocloak/v12"
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func dataSourceKeycloakRealmRole() *schema.Resource {
+	dataSourceSchema := map[string]*schema.Schema{
+		"realm_id": {
+			Type:     schema.TypeString,
+			Required: true,
+		},
+		"name": {
+			Type:     schema.TypeString,
+			Required: true,
+		},
+	}
+	for key, value := range dataSourceRoleSchema() {
+		dataSourceSchema[key] = value
+	}
+
+	return &schema.Resource{
+		ReadContext: dataSourceKeycloakRealmRoleRead,
+		Schema:      dataSourceSchema,
+	}
+}
+
+// dataSourceRoleSchema holds the attributes the role data sources have in
+// common, the role is looked up by the attributes each adds to it
+func dataSourceRoleSchema() map[string]*schema.Schema {
+	return map[string]*schema.Schema{
+		"description": {
+			Type:     schema.TypeString,
+			Computed: true,
+		},
+		"attribute": {
+			Type:     schema.TypeSet,
+			Computed: true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"name": {
+						Type:     schema.TypeString,
+						Computed: true,
+					},
+					"values": {
+						Type:     schema.TypeList,
+						Computed: true,
+						Elem:     &schema.Schema{Type: schema.TypeString},
+					},
+				},
+			},
+		},
+		"composite_realm_roles": {
+			Type:        schema.TypeSet,
+			Computed:    true,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+			Description: "names of the realm roles that are direct composites of the role",
+		},
+		"composite_client_roles": {
+			Type:        schema.TypeSet,
+			Computed:    true,
+			Elem:        dataSourceClientRoleElem(),
+			Description: "client roles that are direct composites of the role",
+		},
+		"expand_composites": {
+			Type:        schema.TypeBool,
+			Optional:    true,
+			Default:     false,
+			Description: "whether to look up effective_realm_roles and effective_client_roles",
+		},
+		"effective_realm_roles": {
+			Type:        schema.TypeSet,
+			Computed:    true,
+			Elem:        &schema.Schema{Type: schema.TypeString},
+			Description: "names of all realm roles the role grants through its composites, including nested composites, when expand_composites is set",
+		},
+		"effective_client_roles": {
+			Type:        schema.TypeSet,
+			Computed:    true,
+			Elem:        dataSourceClientRoleElem(),
+			Description: "all client roles the role grants through its composites, including nested composites, when expand_composites is set",
+		},
+	}
+}
+
+func dataSourceClientRoleElem() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"client_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"role_name": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func dataSourceKeycloakRealmRoleRead(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	realm := data.Get("realm_id").(string)
+	name := data.Get("name").(string)
+
+	role, err := getRole(ctx, keycloakCLient, realm, "", name)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	data.SetId(*role.ID)
+
+	if err := setDataSourceRole(ctx, keycloakCLient, data, realm, role); err != nil {
+		return diag.Errorf("could not read realm role %s in realm %s error -> %s", name, realm, err.Error())
+	}
+	return nil
+}
+
+// setDataSourceRole fills the attributes of dataSourceRoleSchema
+func setDataSourceRole(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, data *schema.ResourceData, realm string, role *gocloak.Role) error {
+	data.Set("description", role.Description)
+	data.Set("attribute", flattenRoleAttributes(role.Attributes))
+
+	composites, err := keycloakCLient.GetCompositeRolesByRoleID(ctx, realm, *role.ID)
+	if err != nil {
+		return err
+	}
+	realmRoles, clientRoles, err := flattenCompositeRoles(ctx, keycloakCLient, realm, composites)
+	if err != nil {
+		return err
+	}
+	data.Set("composite_realm_roles", realmRoles)
+	data.Set("composite_client_roles", clientRoles)
+
+	effectiveRealmRoles, effectiveClientRoles := []string{}, []interface{}{}
+	if data.Get("expand_composites").(bool) {
+		effective, err := expandEffectiveRoles(ctx, keycloakCLient, realm, composites)
+		if err != nil {
+			return err
+		}
+		effectiveRealmRoles, effectiveClientRoles, err = flattenCompositeRoles(ctx, keycloakCLient, realm, effective)
+		if err != nil {
+			return err
+		}
+	}
+	data.Set("effective_realm_roles", effectiveRealmRoles)
+	data.Set("effective_client_roles", effectiveClientRoles)
+
+	return nil
+}
+
+// expandEffectiveRoles returns the composites together with all their nested
+// composites, each role once even when composites form a cycle
+func expandEffectiveRoles(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, composites []*gocloak.Role) ([]*gocloak.Role, error) {
+	var effective []*gocloak.Role
+	seen := map[string]bool{}
+	pending := composites
+
+	for len(pending) > 0 {
+		role := pending[0]
+		pending = pending[1:]
+		if seen[*role.ID] {
+			continue
+		}
+		seen[*role.ID] = true
+		effective = append(effective, role)
+
+		if !gocloak.PBool(role.Composite) {
+			continue
+		}
+		nested, err := keycloakCLient.GetCompositeRolesByRoleID(ctx, realm, *role.ID)
+		if err != nil {
+			return nil, fmt.Errorf("could not get composites of role %s error -> %s", *role.Name, err.Error())
+		}
+		pending = append(pending, nested...)
+	}
+
+	return effective, nil
+}
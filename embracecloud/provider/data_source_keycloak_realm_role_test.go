@@ -0,0 +1,84 @@
+package provider
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+)
+
+func TestDataSourceKeycloakRealmRole_basic(t *testing.T) {
+	server := testKeycloak(t)
+	admin := server.CreateRealmRole(testRealm, "admin")
+	reader := server.CreateRealmRole(testRealm, "reader")
+	manager := server.CreateRealmRole(testRealm, "manager")
+	writer := server.CreateRealmRole(testRealm, "writer")
+	tenantReader := server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	server.UpdateRole(testRealm, admin, "administers", map[string][]string{"scope": {"tenant", "global"}})
+	server.AddComposite(testRealm, admin, reader)
+	server.AddComposite(testRealm, admin, manager)
+	server.AddComposite(testRealm, manager, writer)
+	server.AddComposite(testRealm, manager, tenantReader)
+	// a cycle back to the role itself
+	server.AddComposite(testRealm, writer, admin)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+data "embracecloud_realm_role" "direct" {
+  realm_id = %[1]q
+  name     = "admin"
+}
+
+data "embracecloud_realm_role" "effective" {
+  realm_id          = %[1]q
+  name              = "admin"
+  expand_composites = true
+}
+`, testRealm),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("data.embracecloud_realm_role.direct", "id", admin),
+					resource.TestCheckResourceAttr("data.embracecloud_realm_role.direct", "description", "administers"),
+					resource.TestCheckTypeSetElemNestedAttrs("data.embracecloud_realm_role.direct", "attribute.*", map[string]string{"name": "scope", "values.#": "2", "values.0": "tenant", "values.1": "global"}),
+					resource.TestCheckResourceAttr("data.embracecloud_realm_role.direct", "composite_realm_roles.#", "2"),
+					resource.TestCheckTypeSetElemAttr("data.embracecloud_realm_role.direct", "composite_realm_roles.*", "reader"),
+					resource.TestCheckTypeSetElemAttr("data.embracecloud_realm_role.direct", "composite_realm_roles.*", "manager"),
+					resource.TestCheckResourceAttr("data.embracecloud_realm_role.direct", "composite_client_roles.#", "0"),
+					resource.TestCheckResourceAttr("data.embracecloud_realm_role.direct", "effective_realm_roles.#", "0"),
+
+					resource.TestCheckResourceAttr("data.embracecloud_realm_role.effective", "effective_realm_roles.#", "4"),
+					resource.TestCheckTypeSetElemAttr("data.embracecloud_realm_role.effective", "effective_realm_roles.*", "reader"),
+					resource.TestCheckTypeSetElemAttr("data.embracecloud_realm_role.effective", "effective_realm_roles.*", "manager"),
+					resource.TestCheckTypeSetElemAttr("data.embracecloud_realm_role.effective", "effective_realm_roles.*", "writer"),
+					resource.TestCheckTypeSetElemAttr("data.embracecloud_realm_role.effective", "effective_realm_roles.*", "admin"),
+					resource.TestCheckResourceAttr("data.embracecloud_realm_role.effective", "effective_client_roles.#", "1"),
+					resource.TestCheckTypeSetElemNestedAttrs("data.embracecloud_realm_role.effective", "effective_client_roles.*", map[string]string{"client_id": testClientId, "role_name": "tenant-reader"}),
+				),
+			},
+		},
+	})
+}
+
+func TestDataSourceKeycloakRealmRole_notFound(t *testing.T) {
+	server := testKeycloak(t)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+data "embracecloud_realm_role" "role" {
+  realm_id = %q
+  name     = "admin"
+}
+`, testRealm),
+				ExpectError: regexp.MustCompile("could not find realm role admin in realm test"),
+			},
+		},
+	})
+}
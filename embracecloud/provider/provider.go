@@ -2,12 +2,18 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud"
+	"github.com/hashicorp/go-cty/cty"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
 )
 
+// the values of a role attribute were joined with this in state version 0
+// of the role resources
 const MULTIVALUE_ATTRIBUTE_SEPARATOR = "##"
 
 func Provider() *schema.Provider {
@@ -37,15 +43,130 @@ func Provider() *schema.Provider {
 				DefaultFunc: schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_CLIENT_SECRET", ""),
 				Description: "client secret",
 			},
+			"keycloak_realm": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_REALM", "master"),
+				Description: "realm the provider authenticates against",
+			},
+			"keycloak_grant_type": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_GRANT_TYPE", embracecloud.GrantTypeClientCredentials),
+				Description: "how the provider authenticates, one of client_credentials, password or access_token",
+				ValidateFunc: validation.StringInSlice([]string{
+					embracecloud.GrantTypeClientCredentials,
+					embracecloud.GrantTypePassword,
+					embracecloud.GrantTypeAccessToken,
+				}, false),
+			},
+			"keycloak_username": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_USERNAME", ""),
+				Description: "username for the password grant",
+			},
+			"keycloak_password": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_PASSWORD", ""),
+				Description: "password for the password grant",
+			},
+			"keycloak_access_token": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_ACCESS_TOKEN", ""),
+				Description: "pre-issued access token for the access_token grant, it is used as is and never refreshed",
+			},
+			"keycloak_ca_cert": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_CA_CERT", ""),
+				Description: "PEM encoded ca bundle, or the path of a file holding it, used to verify the keycloak certificate",
+			},
+			"keycloak_client_cert": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_CLIENT_CERT", ""),
+				Description: "PEM encoded client certificate, or the path of a file holding it, for mutual tls",
+			},
+			"keycloak_client_key": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				Sensitive:   true,
+				DefaultFunc: schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_CLIENT_KEY", ""),
+				Description: "PEM encoded private key of the client certificate, or the path of a file holding it",
+			},
+			"keycloak_tls_insecure_skip_verify": {
+				Type:        schema.TypeBool,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_TLS_INSECURE_SKIP_VERIFY", false),
+				Description: "skip verification of the keycloak certificate, only meant for local development",
+			},
+			"keycloak_proxy_url": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				DefaultFunc: schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_PROXY_URL", ""),
+				Description: "http proxy used for all keycloak requests",
+			},
+			"keycloak_timeout": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_TIMEOUT", 0),
+				Description:  "timeout in seconds of a single keycloak request, not counting the wait for max_concurrent_requests or requests_per_second, 0 means no timeout",
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"keycloak_headers": {
+				Type:        schema.TypeMap,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "static headers added to every keycloak request",
+			},
+			"keycloak_max_retries": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_MAX_RETRIES", 3),
+				Description:  "how often a request failing with a transient error is retried, 0 disables retries",
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"keycloak_max_retry_wait": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_MAX_RETRY_WAIT", 30),
+				Description:  "maximum wait in seconds between two attempts, also caps the Retry-After header",
+				ValidateFunc: validation.IntAtLeast(1),
+			},
+			"keycloak_max_concurrent_requests": {
+				Type:         schema.TypeInt,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_MAX_CONCURRENT_REQUESTS", 0),
+				Description:  "maximum number of keycloak requests in flight at the same time, 0 means no limit",
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"keycloak_requests_per_second": {
+				Type:         schema.TypeFloat,
+				Optional:     true,
+				DefaultFunc:  schema.EnvDefaultFunc("EMBRACECLOUD_KEYCLOACK_REQUESTS_PER_SECOND", 0.0),
+				Description:  "maximum number of keycloak requests started per second, 0 means no limit",
+				ValidateFunc: validation.FloatAtLeast(0),
+			},
 		},
 		ResourcesMap: map[string]*schema.Resource{
 			"embracecloud_realm_role":             resourceKeycloakRealmRole(),
 			"embracecloud_realm_role_composite":   resourceKeycloakRealmRoleComposite(),
 			"embracecloud_client_role":            resourceKeycloakClientRole(),
 			"embracecloud_client_role_composite":  resourceKeycloakClientRoleComposite(),
+			"embracecloud_role_composites":        resourceKeycloakRoleComposites(),
+			"embracecloud_role_migration":         resourceKeycloakRoleMigration(),
 			"embracecloud_serviceaccount_details": resourceKeycloakServiceAccountDetails(),
 		},
-		DataSourcesMap:       map[string]*schema.Resource{},
+		DataSourcesMap: map[string]*schema.Resource{
+			"embracecloud_realm_role":   dataSourceKeycloakRealmRole(),
+			"embracecloud_client_role":  dataSourceKeycloakClientRole(),
+			"embracecloud_client_roles": dataSourceKeycloakClientRoles(),
+		},
 		ConfigureContextFunc: providerConfigure,
 	}
 }
@@ -57,13 +178,60 @@ func providerConfigure(ctx context.Context, d *schema.ResourceData) (interface{}
 	embraceCloudClient := embracecloud.BuildClient()
 
 	if d.Get("keycloak_enabled").(bool) == true {
-		embraceCloudClient.InitKeycloak(
-			ctx,
-			d.Get("keycloak_url").(string),
-			d.Get("keycloak_client_id").(string),
-			d.Get("keycloak_client_secret").(string))
+		config := embracecloud.KeycloakConfig{
+			Url:          d.Get("keycloak_url").(string),
+			Realm:        d.Get("keycloak_realm").(string),
+			GrantType:    d.Get("keycloak_grant_type").(string),
+			ClientId:     d.Get("keycloak_client_id").(string),
+			ClientSecret: d.Get("keycloak_client_secret").(string),
+			Username:     d.Get("keycloak_username").(string),
+			Password:     d.Get("keycloak_password").(string),
+			AccessToken:  d.Get("keycloak_access_token").(string),
+
+			CACert:                d.Get("keycloak_ca_cert").(string),
+			ClientCert:            d.Get("keycloak_client_cert").(string),
+			ClientKey:             d.Get("keycloak_client_key").(string),
+			TLSInsecureSkipVerify: d.Get("keycloak_tls_insecure_skip_verify").(bool),
+			ProxyUrl:              d.Get("keycloak_proxy_url").(string),
+			Timeout:               time.Duration(d.Get("keycloak_timeout").(int)) * time.Second,
+			Headers:               expandStringMap(d.Get("keycloak_headers").(map[string]interface{})),
+
+			MaxRetries:   d.Get("keycloak_max_retries").(int),
+			MaxRetryWait: time.Duration(d.Get("keycloak_max_retry_wait").(int)) * time.Second,
+
+			MaxConcurrentRequests: d.Get("keycloak_max_concurrent_requests").(int),
+			RequestsPerSecond:     d.Get("keycloak_requests_per_second").(float64),
+		}
+
+		// settings that are still unknown are checked again on the first
+		// keycloak call, the login waits for it anyway
+		for _, key := range config.MissingSettings() {
+			if settingUnknown(ctx, key) {
+				continue
+			}
+			diags = append(diags, diag.Diagnostic{
+				Severity:      diag.Error,
+				Summary:       fmt.Sprintf("Missing %s", key),
+				Detail:        fmt.Sprintf("%s is required when keycloak_enabled is true and keycloak_grant_type is %s", key, config.GrantType),
+				AttributePath: cty.GetAttrPath(key),
+			})
+		}
+		if diags.HasError() {
+			return nil, diags
+		}
+
+		embraceCloudClient.ConfigureKeycloak(config)
 	}
 
 	return embraceCloudClient, diags
 
 }
+
+func expandStringMap(m map[string]interface{}) map[string]string {
+	result := map[string]string{}
+	for k, v := range m {
+		result[k] = v.(string)
+	}
+
+	return result
+}
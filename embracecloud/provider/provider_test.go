@@ -0,0 +1,256 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud"
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/go-cty/cty/msgpack"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+const (
+	testRealm    = "test"
+	testClientId = "test-client"
+)
+
+var testAccProviderFactories = map[string]func() (*schema.Provider, error){
+	"embracecloud": func() (*schema.Provider, error) {
+		return Provider(), nil
+	},
+}
+
+func TestProvider(t *testing.T) {
+	if err := Provider().InternalValidate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProvider_missingSetting(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: `
+provider "embracecloud" {
+  keycloak_enabled   = true
+  keycloak_url       = "https://keycloak.test"
+  keycloak_client_id = "terraform"
+}
+
+data "embracecloud_realm_role" "role" {
+  realm_id = "test"
+  name     = "admin"
+}
+`,
+				ExpectError: regexp.MustCompile("Missing keycloak_client_secret"),
+			},
+		},
+	})
+}
+
+// testConfigureProvider configures the provider through Server with settings,
+// the settings that are not given are null
+func testConfigureProvider(t *testing.T, settings map[string]cty.Value) []*tfprotov5.Diagnostic {
+	t.Helper()
+
+	configType := schema.InternalMap(Provider().Schema).CoreConfigSchema().ImpliedType()
+	values := map[string]cty.Value{}
+	for key, attributeType := range configType.AttributeTypes() {
+		values[key] = cty.NullVal(attributeType)
+	}
+	for key, value := range settings {
+		values[key] = value
+	}
+	config, err := msgpack.Marshal(cty.ObjectVal(values), configType)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := Server().ConfigureProvider(context.Background(), &tfprotov5.ConfigureProviderRequest{
+		Config: &tfprotov5.DynamicValue{MsgPack: config},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp.Diagnostics
+}
+
+func TestServerReportsMissingSettings(t *testing.T) {
+	diags := testConfigureProvider(t, map[string]cty.Value{
+		"keycloak_enabled":   cty.True,
+		"keycloak_client_id": cty.StringVal("terraform"),
+	})
+
+	if len(diags) != 2 {
+		t.Fatalf("expected the url and the secret to be reported, got %v", diags)
+	}
+	for i, key := range []string{"keycloak_url", "keycloak_client_secret"} {
+		if diags[i].Summary != "Missing "+key {
+			t.Errorf("expected %q, got %q", "Missing "+key, diags[i].Summary)
+		}
+		if expected := tftypes.NewAttributePath().WithAttributeName(key); !diags[i].Attribute.Equal(expected) {
+			t.Errorf("expected the diagnostic on %s, got %v", key, diags[i].Attribute)
+		}
+	}
+}
+
+func TestServerSkipsUnknownSettings(t *testing.T) {
+	// the url comes from a resource that is not created yet
+	diags := testConfigureProvider(t, map[string]cty.Value{
+		"keycloak_enabled":       cty.True,
+		"keycloak_url":           cty.UnknownVal(cty.String),
+		"keycloak_client_id":     cty.StringVal("terraform"),
+		"keycloak_client_secret": cty.UnknownVal(cty.String),
+	})
+
+	if len(diags) != 0 {
+		t.Fatalf("expected unknown settings to be checked on first use, got %v", diags)
+	}
+}
+
+// testRoleValue builds the state or config of a role resource, attributes that
+// are not given are null and blocks are empty
+func testRoleValue(t *testing.T, stateType cty.Type, attributes map[string]cty.Value) *tfprotov5.DynamicValue {
+	t.Helper()
+
+	values := map[string]cty.Value{}
+	for key, attributeType := range stateType.AttributeTypes() {
+		switch {
+		case attributeType.IsListType():
+			values[key] = cty.ListValEmpty(attributeType.ElementType())
+		case attributeType.IsSetType():
+			values[key] = cty.SetValEmpty(attributeType.ElementType())
+		default:
+			values[key] = cty.NullVal(attributeType)
+		}
+	}
+	for key, value := range attributes {
+		values[key] = value
+	}
+
+	value, err := msgpack.Marshal(cty.ObjectVal(values), stateType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tfprotov5.DynamicValue{MsgPack: value}
+}
+
+func TestServerWarnsAboutRenamedRoles(t *testing.T) {
+	stateType := resourceKeycloakRealmRole().CoreConfigSchema().ImpliedType()
+	plan := func(oldName string, newName string) []*tfprotov5.Diagnostic {
+		t.Helper()
+
+		prior := map[string]cty.Value{
+			"id":          cty.StringVal(oldName),
+			"realm_id":    cty.StringVal(testRealm),
+			"name":        cty.StringVal(oldName),
+			"keycloak_id": cty.StringVal("1"),
+		}
+		config := map[string]cty.Value{
+			"realm_id": cty.StringVal(testRealm),
+			"name":     cty.StringVal(newName),
+		}
+		proposed := map[string]cty.Value{
+			"id":          cty.StringVal(oldName),
+			"realm_id":    cty.StringVal(testRealm),
+			"name":        cty.StringVal(newName),
+			"keycloak_id": cty.StringVal("1"),
+		}
+
+		resp, err := Server().PlanResourceChange(context.Background(), &tfprotov5.PlanResourceChangeRequest{
+			TypeName:         "embracecloud_realm_role",
+			PriorState:       testRoleValue(t, stateType, prior),
+			ProposedNewState: testRoleValue(t, stateType, proposed),
+			Config:           testRoleValue(t, stateType, config),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.Diagnostics
+	}
+
+	diags := plan("reader", "viewer")
+	if len(diags) != 1 || diags[0].Severity != tfprotov5.DiagnosticSeverityWarning || diags[0].Summary != "role reader is renamed to viewer" {
+		t.Fatalf("expected a warning about the rename, got %v", diags)
+	}
+
+	if diags := plan("reader", "reader"); len(diags) != 0 {
+		t.Errorf("expected no warning without a rename, got %v", diags)
+	}
+}
+
+// testAccPreCheckTerraform skips tests that drive the terraform cli when it is
+// neither configured through TF_ACC_TERRAFORM_PATH nor found on the PATH
+func testAccPreCheckTerraform(t *testing.T) {
+	if os.Getenv("TF_ACC_TERRAFORM_PATH") != "" {
+		return
+	}
+	if _, err := exec.LookPath("terraform"); err != nil {
+		t.Skip("terraform cli not found, set TF_ACC_TERRAFORM_PATH to run this test")
+	}
+}
+
+// testKeycloak starts a fake keycloak with the test realm and client
+func testKeycloak(t *testing.T) *keycloaktest.Server {
+	server := keycloaktest.NewServer(t)
+	server.CreateRealm(testRealm)
+	server.CreateClient(testRealm, testClientId)
+
+	return server
+}
+
+// testProviderClient returns the client the provider configures for server
+func testProviderClient(server *keycloaktest.Server) *embracecloud.EmbraceCloudClient {
+	client := embracecloud.BuildClient()
+	client.ConfigureKeycloak(embracecloud.KeycloakConfig{
+		Url:          server.URL,
+		Realm:        "master",
+		ClientId:     server.ClientId,
+		ClientSecret: server.ClientSecret,
+	})
+
+	return client
+}
+
+// testKeycloakAPI returns the api the provider would use to talk to server
+func testKeycloakAPI(t *testing.T, server *keycloaktest.Server) embracecloud.KeycloakAPI {
+	api, err := testProviderClient(server).GetKeycloakClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return api
+}
+
+func testProviderConfig(server *keycloaktest.Server) string {
+	return fmt.Sprintf(`
+provider "embracecloud" {
+  keycloak_enabled       = true
+  keycloak_url           = %q
+  keycloak_client_id     = %q
+  keycloak_client_secret = %q
+}
+`, server.URL, server.ClientId, server.ClientSecret)
+}
+
+// testHclList renders values as a terraform list of strings
+func testHclList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = fmt.Sprintf("%q", value)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
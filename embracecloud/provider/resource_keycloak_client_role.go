@@ -17,9 +17,57 @@ func resourceKeycloakClientRole() *schema.Resource {
 		ReadContext:   resourceKeycloakClientRoleRead,
 		DeleteContext: resourceKeycloakClientRoleDelete,
 		UpdateContext: resourceKeycloakClientRoleUpdate,
+		CustomizeDiff: resourceKeycloakClientRoleClientDiff,
+		// This resource can be imported using {{realm}}/{{clientId}}/{{roleName}}. The clientId is the client id as shown in the admin console, not its GUID
 		Importer: &schema.ResourceImporter{
 			StateContext: resourceKeycloakClientRoleImport,
 		},
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceKeycloakClientRoleV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceKeycloakRoleStateUpgradeV0,
+			},
+		},
+		Schema: map[string]*schema.Schema{
+			"realm_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"client_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			// id of the client the role was created in, a client that is
+			// recreated with the same client id gets a new one
+			"client_uuid": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			// renaming keeps the role, its id and everything that refers to it
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"attribute":       attributeSchema(),
+			"attributes":      attributesSchema(),
+			"attributes_mode": attributesModeSchema(),
+			"composite_roles": compositeRolesSchema(),
+		},
+	}
+}
+
+// resourceKeycloakClientRoleV0 is the schema of state version 0, in which the
+// values of an attribute were joined with MULTIVALUE_ATTRIBUTE_SEPARATOR
+func resourceKeycloakClientRoleV0() *schema.Resource {
+	return &schema.Resource{
 		Schema: map[string]*schema.Schema{
 			"realm_id": {
 				Type:     schema.TypeString,
@@ -44,18 +92,14 @@ func resourceKeycloakClientRole() *schema.Resource {
 				Type:     schema.TypeMap,
 				Optional: true,
 			},
+			"composite_roles": compositeRolesSchema(),
 		},
 	}
 }
 
 func mapClientRole(data *schema.ResourceData) (rl gocloak.Role, realm string) {
 
-	attributes := map[string][]string{}
-	if v, ok := data.GetOk("attributes"); ok {
-		for key, value := range v.(map[string]interface{}) {
-			attributes[key] = strings.Split(value.(string), MULTIVALUE_ATTRIBUTE_SEPARATOR)
-		}
-	}
+	attributes := roleAttributes(data.Get("attribute"), data.Get("attributes"))
 
 	role := gocloak.Role{
 		ID:          gocloak.StringP(data.Id()),
@@ -67,48 +111,46 @@ func mapClientRole(data *schema.ResourceData) (rl gocloak.Role, realm string) {
 }
 
 func mapFromClientRoleToData(data *schema.ResourceData, role gocloak.Role) {
-	attributes := map[string]string{}
-	for k, v := range *role.Attributes {
-		attributes[k] = strings.Join(v, MULTIVALUE_ATTRIBUTE_SEPARATOR)
-	}
-
 	data.Set("realm_id", data.Get("realm_id").(string))
 	data.Set("name", role.Name)
 	data.Set("description", role.Description)
-	data.Set("attributes", attributes)
+	setRoleAttributes(data, managedRoleAttributes(data, role.Attributes))
 }
 
 func resourceKeycloakClientRoleCreate(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	role, realm := mapClientRole(data)
 	clientId := data.Get("client_id").(string)
 
-	var params = gocloak.GetClientsParams{
-		ClientID: &clientId,
-	}
-
-	clients, err := keycloakCLient.GetClients(ctx, token.AccessToken, realm, params)
-
+	idOfClient, err := keycloakCLient.GetClientUUID(ctx, realm, clientId)
 	if err != nil {
-		return diag.Errorf(fmt.Sprintf("cannot find client %s in realm %s", clientId, realm))
-	}
-	if len(clients) < 1 {
-		return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s", clientId, realm))
-	}
-
-	if len(clients) > 1 {
-		return diag.Errorf("multiple clients found")
+		return diag.FromErr(err)
 	}
 
-	id, err := keycloakCLient.CreateClientRole(ctx, token.AccessToken, realm, *clients[0].ID,
+	id, err := keycloakCLient.CreateClientRole(ctx, realm, idOfClient,
 		role)
 
 	if err != nil {
+		// a role of the same name, for example one that came back with a
+		// recreated client, is not taken over without an import
+		if embracecloud.IsConflict(err) {
+			return diag.Errorf("client role %s already exists in client %s in realm %s, import it with the id %s/%s/%s to manage it", *role.Name, clientId, realm, realm, clientId, *role.Name)
+		}
 		return diag.Errorf("failed to create client role %s in client %s in realm %s error -> %s", *role.Name, clientId, realm, err.Error())
 	}
 
 	data.SetId(id)
+	data.Set("client_uuid", idOfClient)
+
+	if _, ok := data.GetOk("composite_roles"); ok {
+		if diags := resourceKeycloakClientRoleApplyCompositeRoles(ctx, keycloakCLient, data); diags.HasError() {
+			return diags
+		}
+	}
 
 	return resourceKeycloakClientRoleRead(ctx, data, meta)
 
@@ -116,96 +158,223 @@ func resourceKeycloakClientRoleCreate(ctx context.Context, data *schema.Resource
 
 func resourceKeycloakClientRoleRead(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	clientId := data.Get("client_id").(string)
 	_, realm := mapClientRole(data)
 
-	var params = gocloak.GetClientsParams{
-		ClientID: &clientId,
-	}
-	clients, err := keycloakCLient.GetClients(ctx, token.AccessToken, realm, params)
-
+	idOfClient, err := keycloakCLient.GetClientUUID(ctx, realm, clientId)
 	if err != nil {
-		return diag.Errorf(fmt.Sprintf("cannot find client %s in realm %s", clientId, realm))
-	}
-	if len(clients) < 1 {
-		return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s", clientId, realm))
+		// the client was deleted outside terraform and its roles with it
+		if embracecloud.IsNotFound(err) {
+			data.SetId("")
+			return nil
+		}
+		return diag.FromErr(err)
 	}
 
-	if len(clients) > 1 {
-		return diag.Errorf("multiple clients found")
+	// the role went away with the client it was created in, a role of the
+	// same name in the new client is a different one
+	if stored := data.Get("client_uuid").(string); stored != "" && stored != idOfClient {
+		data.SetId("")
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  fmt.Sprintf("client %s in realm %s was recreated", clientId, realm),
+			Detail:   fmt.Sprintf("client role %s went away with the old client and is created again in the new one", data.Get("name").(string)),
+		}}
 	}
+	data.Set("client_uuid", idOfClient)
 
-	readRole, err := keycloakCLient.GetClientRole(ctx, token.AccessToken, realm, *clients[0].ID, data.Id())
+	readRole, err := keycloakCLient.GetClientRole(ctx, realm, idOfClient, data.Id())
 	if err != nil {
+		if embracecloud.IsNotFound(err) {
+			data.SetId("")
+			return nil
+		}
 		return diag.Errorf(fmt.Sprintf("Could not find client role in client %s with name %s in realm %s error -> %s", clientId, data.Id(), realm, err.Error()))
 	}
 
-	mapFromRoleToData(data, *readRole)
+	mapFromClientRoleToData(data, *readRole)
+
+	if err := readInlineCompositeRoles(ctx, keycloakCLient, data, realm, *readRole.ID); err != nil {
+		return diag.Errorf("could not get composites of client role %s in client %s in realm %s error -> %s", data.Id(), clientId, realm, err.Error())
+	}
 	return nil
 }
 
 func resourceKeycloakClientRoleUpdate(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	role, realm := mapRole(data)
 	clientId := data.Get("client_id").(string)
 
-	var params = gocloak.GetClientsParams{
-		ClientID: &clientId,
+	idOfClient, err := keycloakCLient.GetClientUUID(ctx, realm, clientId)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	merge := data.Get("attributes_mode").(string) == attributesModeMerge
+	var current *gocloak.Role
+	if merge || data.HasChange("name") {
+		current, err = keycloakCLient.GetClientRole(ctx, realm, idOfClient, data.Id())
+		if err != nil {
+			return diag.Errorf(fmt.Sprintf("Could not find client role in client %s with name %s in realm %s error -> %s", clientId, data.Id(), realm, err.Error()))
+		}
+	}
+	if merge {
+		attributes := mergeRoleAttributes(data, current.Attributes)
+		role.Attributes = &attributes
+	}
+
+	// UpdateRole addresses the role by the name in the body, which does not
+	// exist yet when renaming
+	if data.HasChange("name") {
+		role.ID = current.ID
+		err = keycloakCLient.UpdateRoleByID(ctx, realm, *current.ID, role)
+	} else {
+		err = keycloakCLient.UpdateRole(ctx, realm, idOfClient, role)
 	}
-	clients, err := keycloakCLient.GetClients(ctx, token.AccessToken, realm, params)
 
 	if err != nil {
-		return diag.Errorf(fmt.Sprintf("cannot find client %s in realm %s", clientId, realm))
+		return diag.Errorf(fmt.Sprintf("failed to update client role %s for client %s in realm %s error -> %s", clientId, *role.Name, realm, err.Error()))
 	}
-	if len(clients) < 1 {
-		return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s", clientId, realm))
+
+	var warnings diag.Diagnostics
+	if data.HasChange("name") {
+		data.SetId(*role.Name)
+		oldName, _ := data.GetChange("name")
+		warnings = roleRenameWarnings(ctx, keycloakCLient, realm, idOfClient, oldName.(string), *role.Name)
 	}
 
-	if len(clients) > 1 {
-		return diag.Errorf("multiple clients found")
+	if data.HasChange("composite_roles") {
+		if diags := resourceKeycloakClientRoleApplyCompositeRoles(ctx, keycloakCLient, data); diags.HasError() {
+			return diags
+		}
 	}
 
-	err = keycloakCLient.UpdateRole(ctx, token.AccessToken, realm, *clients[0].ID, role)
+	return append(warnings, resourceKeycloakClientRoleRead(ctx, data, meta)...)
+}
+
+func resourceKeycloakClientRoleApplyCompositeRoles(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, data *schema.ResourceData) diag.Diagnostics {
+	realm := data.Get("realm_id").(string)
+	clientId := data.Get("client_id").(string)
 
+	role, err := getRole(ctx, keycloakCLient, realm, clientId, data.Id())
 	if err != nil {
-		return diag.Errorf(fmt.Sprintf("failed to update client role %s for client %s in realm %s error -> %s", clientId, *role.Name, realm, err.Error()))
+		return diag.FromErr(err)
 	}
 
-	return resourceKeycloakClientRoleRead(ctx, data, meta)
+	if err := applyInlineCompositeRoles(ctx, keycloakCLient, data, realm, *role.ID); err != nil {
+		return diag.Errorf("could not set composites of client role %s in client %s in realm %s error -> %s", *role.Name, clientId, realm, err.Error())
+	}
+	return nil
 }
 
 func resourceKeycloakClientRoleDelete(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	role, realm := mapRole(data)
 	clientId := data.Get("client_id").(string)
-	var params = gocloak.GetClientsParams{
-		ClientID: &clientId,
+	// the role is deleted from the client it was created in, which is not the
+	// one behind the client id when the client was recreated
+	idOfClient := data.Get("client_uuid").(string)
+	if idOfClient == "" {
+		idOfClient, err = keycloakCLient.GetClientUUID(ctx, realm, clientId)
+		if err != nil {
+			return diag.FromErr(err)
+		}
 	}
 
-	clients, err := keycloakCLient.GetClients(ctx, token.AccessToken, realm, params)
+	err = keycloakCLient.DeleteClientRole(ctx, realm, idOfClient, *role.ID)
 
+	// the role is gone already, a recreated client took its roles with it
+	if err != nil && embracecloud.IsNotFound(err) {
+		return nil
+	}
 	if err != nil {
-		return diag.Errorf(fmt.Sprintf("cannot find client %s in realm %s", clientId, realm))
+		return diag.Errorf(fmt.Sprintf("failed to delete client role %s for client %s in realm %s error -> %s", clientId, *role.Name, realm, err.Error()))
+	}
+	return nil
+}
+
+func resourceKeycloakClientRoleImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.SplitN(d.Id(), "/", 3)
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid import id %s, expected {{realm}}/{{clientId}}/{{roleName}}", d.Id())
 	}
-	if len(clients) < 1 {
-		return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s", clientId, realm))
+	realm, clientId, roleName := parts[0], parts[1], parts[2]
+
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(clients) > 1 {
-		return diag.Errorf("multiple clients found")
+	idOfClient, err := keycloakCLient.GetClientUUID(ctx, realm, clientId)
+	if err != nil {
+		return nil, err
 	}
-	err = keycloakCLient.DeleteClientRole(ctx, token.AccessToken, realm, *clients[0].ID, *role.ID)
 
+	role, err := keycloakCLient.GetClientRole(ctx, realm, idOfClient, roleName)
 	if err != nil {
-		return diag.Errorf(fmt.Sprintf("failed to delete client role %s for client %s in realm %s error -> %s", clientId, *role.Name, realm, err.Error()))
+		if embracecloud.IsNotFound(err) {
+			return nil, fmt.Errorf("no client role with name %s found in client %s in realm %s", roleName, clientId, realm)
+		}
+		return nil, fmt.Errorf("could not find client role in client %s with name %s in realm %s error -> %s", clientId, roleName, realm, err.Error())
 	}
-	return nil
-}
 
-func resourceKeycloakClientRoleImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	d.SetId(*role.Name)
+	d.Set("realm_id", realm)
+	d.Set("client_id", clientId)
+	mapFromClientRoleToData(d, *role)
 
 	return []*schema.ResourceData{d}, nil
 }
+
+// resourceKeycloakClientRoleClientDiff replaces the role when the client
+// behind its client id is not the one it was created in anymore
+func resourceKeycloakClientRoleClientDiff(ctx context.Context, d *schema.ResourceDiff, meta interface{}) error {
+	// only an existing role that stays in the client it knows the id of
+	// can have lost its client
+	stored := d.Get("client_uuid").(string)
+	if d.Id() == "" || stored == "" || !d.NewValueKnown("client_uuid") {
+		return nil
+	}
+	if !d.NewValueKnown("realm_id") || !d.NewValueKnown("client_id") || d.HasChange("realm_id") || d.HasChange("client_id") {
+		return nil
+	}
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return err
+	}
+
+	idOfClient, err := keycloakCLient.GetClientUUID(ctx, d.Get("realm_id").(string), d.Get("client_id").(string))
+	if err != nil {
+		// without a refresh the client may be gone, the role is created again
+		// in whichever client has the client id by then
+		if embracecloud.IsNotFound(err) {
+			if err := d.SetNewComputed("client_uuid"); err != nil {
+				return err
+			}
+			return d.ForceNew("client_uuid")
+		}
+		return err
+	}
+	if idOfClient == stored {
+		return nil
+	}
+
+	if err := d.SetNew("client_uuid", idOfClient); err != nil {
+		return err
+	}
+	return d.ForceNew("client_uuid")
+}
@@ -15,9 +15,55 @@ func resourceKeycloakClientRoleComposite() *schema.Resource {
 		CreateContext: resourceKeycloakClientRoleCompositeCreate,
 		ReadContext:   resourceKeycloakClientRoleCompositeRead,
 		DeleteContext: resourceKeycloakClientRoleCompositeDelete,
+		// This resource can be imported using {{realm}}/{{clientId}}/{{parentRoleName}}/{{compositeClientId}}/{{compositeRoleName}},
+		// with {{compositeClientId}} left empty when the composite is a realm role
 		Importer: &schema.ResourceImporter{
 			StateContext: resourceKeycloakClientRoleCompositeImport,
 		},
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceKeycloakClientRoleCompositeV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceKeycloakClientRoleCompositeStateUpgradeV0,
+			},
+		},
+		Schema: map[string]*schema.Schema{
+			"realm_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"parent_role_name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"client_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			"composite_client_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+
+			"composite_role_name": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Required: true,
+			},
+		},
+	}
+}
+
+// resourceKeycloakClientRoleCompositeV0 is the schema of state version 0, in
+// which the id was the parent role name. The attributes are unchanged.
+func resourceKeycloakClientRoleCompositeV0() *schema.Resource {
+	return &schema.Resource{
 		Schema: map[string]*schema.Schema{
 			"realm_id": {
 				Type:     schema.TypeString,
@@ -52,31 +98,22 @@ func resourceKeycloakClientRoleComposite() *schema.Resource {
 
 func resourceKeycloakClientRoleCompositeCreate(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	realm := data.Get("realm_id").(string)
 	roleName := data.Get("parent_role_name").(string)
 	clientId := data.Get("client_id").(string)
 	compositeClientId, isClient := data.GetOkExists("composite_client_id")
 	composteRoleName := data.Get("composite_role_name").(string)
 
-	var params = gocloak.GetClientsParams{
-		ClientID: &clientId,
-	}
-
-	clients, err := keycloakCLient.GetClients(ctx, token.AccessToken, realm, params)
-
+	idOfClient, err := keycloakCLient.GetClientUUID(ctx, realm, clientId)
 	if err != nil {
-		return diag.Errorf(fmt.Sprintf("cannot find client %s in realm %s", clientId, realm))
-	}
-	if len(clients) < 1 {
-		return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s", clientId, realm))
-	}
-
-	if len(clients) > 1 {
-		return diag.Errorf("multiple clients found")
+		return diag.FromErr(err)
 	}
 
-	role, err := keycloakCLient.GetClientRole(ctx, token.AccessToken, realm, *clients[0].ID, roleName)
+	role, err := keycloakCLient.GetClientRole(ctx, realm, idOfClient, roleName)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -84,52 +121,40 @@ func resourceKeycloakClientRoleCompositeCreate(ctx context.Context, data *schema
 	var compRole []gocloak.Role
 
 	if isClient == true {
-		var compClientId = compositeClientId.(string)
-		var params = gocloak.GetClientsParams{
-			ClientID: &compClientId,
-		}
-
-		compClients, err := keycloakCLient.GetClients(ctx, token.AccessToken, realm, params)
-
+		idOfCompClient, err := keycloakCLient.GetClientUUID(ctx, realm, compositeClientId.(string))
 		if err != nil {
-			return diag.Errorf(fmt.Sprintf("cannot find client %s in realm %s", clientId, realm))
-		}
-		if len(clients) < 1 {
-			return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s", clientId, realm))
+			return diag.FromErr(err)
 		}
 
-		if len(clients) > 1 {
-			return diag.Errorf("multiple clients found")
-		}
-
-		compRoleResponse, err := keycloakCLient.GetClientRole(ctx, token.AccessToken, realm, *compClients[0].ID, composteRoleName)
+		compRoleResponse, err := keycloakCLient.GetClientRole(ctx, realm, idOfCompClient, composteRoleName)
 		if err != nil {
-			return diag.Errorf(fmt.Sprintf("Could not find client role in client %s with name %s in realm %s error -> %s", *compClients[0].ID, composteRoleName, realm, err.Error()))
+			return diag.Errorf(fmt.Sprintf("Could not find client role in client %s with name %s in realm %s error -> %s", idOfCompClient, composteRoleName, realm, err.Error()))
 		}
 
 		compRole = append(compRole, *compRoleResponse)
 
-		err = keycloakCLient.AddClientRoleComposite(ctx, token.AccessToken, realm, *role.ID, compRole)
+		err = keycloakCLient.AddClientRoleComposite(ctx, realm, *role.ID, compRole)
 		if err != nil {
 			return diag.Errorf(fmt.Sprintf("Cannot add composite client role %s from client %s in realm %s error -> %s", *compRole[0].Name, clientId, realm, err.Error()))
 		}
 
 	} else {
-		compRoleResponse, err := keycloakCLient.GetRealmRole(ctx, token.AccessToken, realm, composteRoleName)
+		compRoleResponse, err := keycloakCLient.GetRealmRole(ctx, realm, composteRoleName)
 		if err != nil {
 
 			return diag.Errorf(fmt.Sprintf("Could not find realm role %s in realm %s error -> %s", composteRoleName, realm, err.Error()))
 		}
 
 		compRole = append(compRole, *compRoleResponse)
-		err = keycloakCLient.AddRealmRoleComposite(ctx, token.AccessToken, data.Get("realm_id").(string), *role.Name, compRole)
+		// the parent is a client role, so it is addressed by id
+		err = keycloakCLient.AddClientRoleComposite(ctx, realm, *role.ID, compRole)
 		if err != nil {
 
 			return diag.Errorf(fmt.Sprintf("Cannot add composite %s to realmrole %s in realm %s error -> %s", *compRole[0].Name, *role.Name, realm, err.Error()))
 		}
 	}
 
-	data.SetId(roleName)
+	data.SetId(compositeId(realm, clientId, roleName, data.Get("composite_client_id").(string), composteRoleName))
 
 	return nil
 
@@ -137,129 +162,119 @@ func resourceKeycloakClientRoleCompositeCreate(ctx context.Context, data *schema
 
 func resourceKeycloakClientRoleCompositeRead(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakClient, token := client.GetKeycloakClient()
+	keycloakClient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	realm := data.Get("realm_id").(string)
 	roleName := data.Get("parent_role_name").(string)
 	clientId := data.Get("client_id").(string)
-	compositeClientId, isClient := data.GetOkExists("composite_client_id")
+	compositeClientId := data.Get("composite_client_id").(string)
 	compositeRoleName := data.Get("composite_role_name").(string)
 
-	// Fetch Client
-	var params = gocloak.GetClientsParams{
-		ClientID: &clientId,
-	}
-
-	clients, err := keycloakClient.GetClients(ctx, token.AccessToken, realm, params)
-	if err != nil || len(clients) < 1 {
-		return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s.", clientId, realm))
-	}
-
-	if len(clients) > 1 {
-		return diag.Errorf("Multiple clients found for ID %s in realm %s", clientId, realm)
-	}
-
-
-	role, err := keycloakClient.GetClientRole(ctx, token.AccessToken, realm, *clients[0].ID, roleName)
+	// the composite went away with either role or their clients
+	role, err := getRole(ctx, keycloakClient, realm, clientId, roleName)
 	if err != nil {
-		return diag.Errorf(fmt.Sprintf("Role %s not found in client %s, realm %s.", roleName, clientId, realm))
-	}
-
-	var compRole *gocloak.Role
-
-
-	compClientId := compositeClientId.(string)
-	var compParams = gocloak.GetClientsParams{
-		ClientID: &compClientId,
+		if embracecloud.IsNotFound(err) {
+			data.SetId("")
+			return nil
+		}
+		return diag.FromErr(err)
 	}
 
-	compClients, err := keycloakClient.GetClients(ctx, token.AccessToken, realm, compParams)
-	if err != nil || len(compClients) < 1 {
-		return diag.Errorf(fmt.Sprintf("client %s not found in realm %s.", compClientId, realm))
+	compRole, err := getRole(ctx, keycloakClient, realm, compositeClientId, compositeRoleName)
+	if err != nil {
+		if embracecloud.IsNotFound(err) {
+			data.SetId("")
+			return nil
+		}
+		return diag.FromErr(err)
 	}
 
-	compRole, err = keycloakClient.GetClientRole(ctx, token.AccessToken, realm, *compClients[0].ID, compositeRoleName)
+	found, err := hasComposite(ctx, keycloakClient, realm, *role.ID, *compRole.ID)
 	if err != nil {
-		data.SetId("") 
+		return diag.Errorf("could not get composites of client role %s in client %s in realm %s error -> %s", roleName, clientId, realm, err.Error())
+	}
+	if !found {
+		// the composite was removed outside terraform
+		data.SetId("")
 	}
-
 
 	return nil
 }
 
 func resourceKeycloakClientRoleCompositeDelete(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	realm := data.Get("realm_id").(string)
 	roleName := data.Get("parent_role_name").(string)
 	clientId := data.Get("client_id").(string)
 	compositeClientId, isClient := data.GetOkExists("composite_client_id")
 	composteRoleName := data.Get("composite_role_name").(string)
 
-	var params = gocloak.GetClientsParams{
-		ClientID: &clientId,
-	}
-
-	clients, err := keycloakCLient.GetClients(ctx, token.AccessToken, realm, params)
-
+	idOfClient, err := keycloakCLient.GetClientUUID(ctx, realm, clientId)
 	if err != nil {
-		return diag.Errorf(fmt.Sprintf("cannot find client %s in realm %s", clientId, realm))
-	}
-	if len(clients) < 1 {
-		return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s", clientId, realm))
-	}
-
-	if len(clients) > 1 {
-		return diag.Errorf("multiple clients found")
+		if embracecloud.IsNotFound(err) {
+			// the client is already removed outside terraform, so are its roles and composites
+			return nil
+		}
+		return diag.FromErr(err)
 	}
 
-	role, err := keycloakCLient.GetClientRole(ctx, token.AccessToken, realm, *clients[0].ID, roleName)
+	role, err := keycloakCLient.GetClientRole(ctx, realm, idOfClient, roleName)
 	if err != nil {
+		if embracecloud.IsNotFound(err) {
+			// the parent role is already removed outside terraform, so is the composite
+			return nil
+		}
 		return diag.FromErr(err)
 	}
 
 	var compRole []gocloak.Role
 
 	if isClient == true {
-		var compClientId = compositeClientId.(string)
-		var params = gocloak.GetClientsParams{
-			ClientID: &compClientId,
-		}
-
-		compClients, err := keycloakCLient.GetClients(ctx, token.AccessToken, realm, params)
-
+		idOfCompClient, err := keycloakCLient.GetClientUUID(ctx, realm, compositeClientId.(string))
 		if err != nil {
-
-			return diag.Errorf(fmt.Sprintf("Could not find client %s in realm %s error -> %s", clientId, realm, err.Error()))
-		}
-		if len(clients) < 1 {
-			return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s", clientId, realm))
+			if embracecloud.IsNotFound(err) {
+				// the client is already removed outside terraform, so is its role
+				return nil
+			}
+			return diag.FromErr(err)
 		}
 
-		if len(clients) > 1 {
-			return diag.Errorf("multiple clients found")
-		}
-		compRoleResponse, err := keycloakCLient.GetClientRole(ctx, token.AccessToken, realm, *compClients[0].ID, composteRoleName)
+		compRoleResponse, err := keycloakCLient.GetClientRole(ctx, realm, idOfCompClient, composteRoleName)
 		if err != nil {
+			if embracecloud.IsNotFound(err) {
+				// client role is already removed outside terraform, the composite cannot exist
+				return nil
+			}
 			return diag.Errorf(fmt.Sprintf("Could not find client role in client %s with name %s in realm %s error -> %s", clientId, composteRoleName, realm, err.Error()))
 		}
 
 		compRole = append(compRole, *compRoleResponse)
 
-		err = keycloakCLient.DeleteClientRoleComposite(ctx, token.AccessToken, realm, *role.ID, compRole)
+		err = keycloakCLient.DeleteClientRoleComposite(ctx, realm, *role.ID, compRole)
 		if err != nil {
 
 			return diag.Errorf(fmt.Sprintf("Cannot delete composite client role %s from client %s in realm %s error -> %s", *compRole[0].Name, clientId, realm, err.Error()))
 		}
 
 	} else {
-		compRoleResponse, err := keycloakCLient.GetRealmRole(ctx, token.AccessToken, realm, composteRoleName)
+		compRoleResponse, err := keycloakCLient.GetRealmRole(ctx, realm, composteRoleName)
 		if err != nil {
+			if embracecloud.IsNotFound(err) {
+				// realm role is already removed outside terraform, the composite cannot exist
+				return nil
+			}
 			return diag.Errorf(fmt.Sprintf("Could not find realm role %s in realm %s error -> %s", composteRoleName, realm, err.Error()))
 		}
 
 		compRole = append(compRole, *compRoleResponse)
 
-		err = keycloakCLient.DeleteRealmRoleComposite(ctx, token.AccessToken, realm, *role.Name, compRole)
+		err = keycloakCLient.DeleteClientRoleComposite(ctx, realm, *role.ID, compRole)
 		if err != nil {
 			return diag.Errorf(fmt.Sprintf("Could not delete composite role %s from realmrole %s in realm %s error -> %s", *compRole[0].Name, *role.Name, realm, err.Error()))
 
@@ -269,6 +284,28 @@ func resourceKeycloakClientRoleCompositeDelete(ctx context.Context, data *schema
 }
 
 func resourceKeycloakClientRoleCompositeImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	realm, parentClientId, parentRoleName, compositeClientId, compositeRoleName, err := parseCompositeId(d.Id())
+	if err != nil {
+		return nil, err
+	}
+	if parentClientId == "" {
+		return nil, fmt.Errorf("invalid import id %s, the parent of a client role composite must be a client role, use embracecloud_realm_role_composite for realm roles", d.Id())
+	}
+
+	d.Set("realm_id", realm)
+	d.Set("client_id", parentClientId)
+	d.Set("parent_role_name", parentRoleName)
+	if compositeClientId != "" {
+		d.Set("composite_client_id", compositeClientId)
+	}
+	d.Set("composite_role_name", compositeRoleName)
 
 	return []*schema.ResourceData{d}, nil
 }
+
+func resourceKeycloakClientRoleCompositeStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	compositeClientId, _ := rawState["composite_client_id"].(string)
+	rawState["id"] = compositeId(rawState["realm_id"].(string), rawState["client_id"].(string), rawState["parent_role_name"].(string), compositeClientId, rawState["composite_role_name"].(string))
+
+	return rawState, nil
+}
@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+func TestResourceKeycloakClientRoleComposite_basic(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateClient(testRealm, "other-client")
+	server.CreateClientRole(testRealm, testClientId, "tenant-admin")
+	server.CreateClientRole(testRealm, "other-client", "tenant-reader")
+	server.CreateRealmRole(testRealm, "reader")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckCompositesDestroy(server, testClientRoleId(server, "tenant-admin")),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_client_role_composite" "realm" {
+  realm_id            = %[1]q
+  client_id           = %[2]q
+  parent_role_name    = "tenant-admin"
+  composite_role_name = "reader"
+}
+
+resource "embracecloud_client_role_composite" "client" {
+  realm_id            = %[1]q
+  client_id           = %[2]q
+  parent_role_name    = "tenant-admin"
+  composite_client_id = "other-client"
+  composite_role_name = "tenant-reader"
+}
+`, testRealm, testClientId),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_client_role_composite.realm", "id", "test/test-client/tenant-admin//reader"),
+					resource.TestCheckResourceAttr("embracecloud_client_role_composite.client", "id", "test/test-client/tenant-admin/other-client/tenant-reader"),
+					testAccCheckComposites(server, testClientRoleId(server, "tenant-admin"), "tenant-reader", "reader"),
+				),
+			},
+			{
+				ResourceName:      "embracecloud_client_role_composite.realm",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName:      "embracecloud_client_role_composite.client",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName:  "embracecloud_client_role_composite.realm",
+				ImportState:   true,
+				ImportStateId: "test//admin//reader",
+				ExpectError:   regexp.MustCompile("use embracecloud_realm_role_composite for realm roles"),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakClientRoleCompositeDelete_goneOutsideTerraform(t *testing.T) {
+	cases := map[string]struct {
+		compositeClientId string
+		gone              func(server *keycloaktest.Server, tenantAdmin string, reader string)
+	}{
+		"client": {
+			gone: func(server *keycloaktest.Server, tenantAdmin string, reader string) {
+				server.DeleteClient(testRealm, testClientId)
+			},
+		},
+		"parent role": {
+			gone: func(server *keycloaktest.Server, tenantAdmin string, reader string) {
+				server.DeleteRole(testRealm, tenantAdmin)
+			},
+		},
+		"realm role": {
+			gone: func(server *keycloaktest.Server, tenantAdmin string, reader string) {
+				server.DeleteRole(testRealm, reader)
+			},
+		},
+		"client role": {
+			compositeClientId: "other-client",
+			gone: func(server *keycloaktest.Server, tenantAdmin string, reader string) {
+				server.DeleteRole(testRealm, reader)
+			},
+		},
+		"client of the composite": {
+			compositeClientId: "other-client",
+			gone: func(server *keycloaktest.Server, tenantAdmin string, reader string) {
+				server.DeleteClient(testRealm, "other-client")
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			server := testKeycloak(t)
+			tenantAdmin := server.CreateClientRole(testRealm, testClientId, "tenant-admin")
+			reader := server.CreateRealmRole(testRealm, "reader")
+			if c.compositeClientId != "" {
+				server.CreateClient(testRealm, c.compositeClientId)
+				reader = server.CreateClientRole(testRealm, c.compositeClientId, "reader")
+			}
+			server.AddComposite(testRealm, tenantAdmin, reader)
+
+			raw := map[string]interface{}{
+				"realm_id":            testRealm,
+				"client_id":           testClientId,
+				"parent_role_name":    "tenant-admin",
+				"composite_role_name": "reader",
+			}
+			if c.compositeClientId != "" {
+				raw["composite_client_id"] = c.compositeClientId
+			}
+			data := schema.TestResourceDataRaw(t, resourceKeycloakClientRoleComposite().Schema, raw)
+			data.SetId(compositeId(testRealm, testClientId, "tenant-admin", c.compositeClientId, "reader"))
+
+			c.gone(server, tenantAdmin, reader)
+			if diags := resourceKeycloakClientRoleCompositeDelete(context.Background(), data, testProviderClient(server)); diags.HasError() {
+				t.Fatalf("expected nothing left to delete, got %v", diags)
+			}
+		})
+	}
+}
+
+func TestResourceKeycloakClientRoleCompositeStateUpgradeV0(t *testing.T) {
+	state, err := resourceKeycloakClientRoleCompositeStateUpgradeV0(context.Background(), map[string]interface{}{
+		"id":                  "tenant-admin",
+		"realm_id":            "test",
+		"client_id":           "test-client",
+		"parent_role_name":    "tenant-admin",
+		"composite_role_name": "reader",
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := "test/test-client/tenant-admin//reader"; state["id"] != id {
+		t.Errorf("expected id %s, got %s", id, state["id"])
+	}
+}
+
+func TestResourceKeycloakClientRoleComposite_drift(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateClientRole(testRealm, testClientId, "tenant-admin")
+	server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	config := testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_client_role_composite" "client" {
+  realm_id            = %[1]q
+  client_id           = %[2]q
+  parent_role_name    = "tenant-admin"
+  composite_client_id = %[2]q
+  composite_role_name = "tenant-reader"
+}
+`, testRealm, testClientId)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckCompositesDestroy(server, testClientRoleId(server, "tenant-admin")),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check:  testAccCheckComposites(server, testClientRoleId(server, "tenant-admin"), "tenant-reader"),
+			},
+			{
+				// composite removed from the parent in the admin console
+				PreConfig: func() {
+					server.RemoveComposite(testRealm, testClientRoleId(server, "tenant-admin"), testClientRoleId(server, "tenant-reader"))
+				},
+				Config: config,
+				Check:  testAccCheckComposites(server, testClientRoleId(server, "tenant-admin"), "tenant-reader"),
+			},
+			{
+				// client of both roles deleted in the admin console
+				PreConfig: func() {
+					server.DeleteClient(testRealm, testClientId)
+				},
+				Config:             config,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
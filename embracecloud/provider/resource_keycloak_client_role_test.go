@@ -0,0 +1,577 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v12"
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceKeycloakClientRole_basic(t *testing.T) {
+	server := testKeycloak(t)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckClientRoleDestroy(server, "tenant-reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testClientRoleConfig("tenant-reader", "can read", "tenant"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_client_role.role", "id", "tenant-reader"),
+					resource.TestCheckResourceAttr("embracecloud_client_role.role", "client_id", testClientId),
+					resource.TestCheckResourceAttr("embracecloud_client_role.role", "description", "can read"),
+					resource.TestCheckTypeSetElemNestedAttrs("embracecloud_client_role.role", "attribute.*", map[string]string{"name": "scope", "values.#": "1", "values.0": "tenant"}),
+					testAccCheckClientRoleDescription(server, "tenant-reader", "can read"),
+				),
+			},
+			{
+				Config: testProviderConfig(server) + testClientRoleConfig("tenant-reader", "can read everything", "tenant", "global"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_client_role.role", "description", "can read everything"),
+					testAccCheckClientRoleDescription(server, "tenant-reader", "can read everything"),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakClientRole_drift(t *testing.T) {
+	server := testKeycloak(t)
+	config := testProviderConfig(server) + testClientRoleConfig("tenant-reader", "can read", "tenant")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckClientRoleDestroy(server, "tenant-reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+			},
+			{
+				// changed in the admin console
+				PreConfig: func() {
+					role := server.ClientRole(testRealm, testClientId, "tenant-reader")
+					server.UpdateRole(testRealm, *role.ID, "changed", map[string][]string{})
+				},
+				Config: config,
+				Check:  testAccCheckClientRoleDescription(server, "tenant-reader", "can read"),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakClientRole_deleted(t *testing.T) {
+	server := testKeycloak(t)
+	config := testProviderConfig(server) + testClientRoleConfig("tenant-reader", "can read", "tenant")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckClientRoleDestroy(server, "tenant-reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+			},
+			{
+				// deleted in the admin console
+				PreConfig: func() {
+					server.DeleteRole(testRealm, *server.ClientRole(testRealm, testClientId, "tenant-reader").ID)
+				},
+				Config: config,
+				Check:  testAccCheckClientRoleDescription(server, "tenant-reader", "can read"),
+			},
+			{
+				// deleted together with its client
+				PreConfig: func() {
+					server.DeleteClient(testRealm, testClientId)
+				},
+				Config:             config,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakClientRole_recreatedClient(t *testing.T) {
+	server := testKeycloak(t)
+	config := testProviderConfig(server) + testClientRoleConfig("tenant-reader", "can read", "tenant")
+	var recreated string
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckClientRoleDestroy(server, "tenant-reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: func(s *terraform.State) error {
+					return resource.TestCheckResourceAttr("embracecloud_client_role.role", "client_uuid", server.ClientUUID(testRealm, testClientId))(s)
+				},
+			},
+			{
+				// deleted and created again, together with an unrelated role
+				PreConfig: func() {
+					server.DeleteClient(testRealm, testClientId)
+					recreated = server.CreateClient(testRealm, testClientId)
+					server.CreateClientRole(testRealm, testClientId, "other")
+				},
+				Config:             config,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					func(s *terraform.State) error {
+						return resource.TestCheckResourceAttr("embracecloud_client_role.role", "client_uuid", recreated)(s)
+					},
+					testAccCheckClientRoleDescription(server, "tenant-reader", "can read"),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakClientRole_recreatedClientWithRole(t *testing.T) {
+	server := testKeycloak(t)
+	config := testProviderConfig(server) + testClientRoleConfig("tenant-reader", "can read", "tenant")
+	var recreated string
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckClientRoleDestroy(server, "tenant-reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+			},
+			{
+				// the new client comes with a role of the same name
+				PreConfig: func() {
+					server.DeleteClient(testRealm, testClientId)
+					recreated = server.CreateClient(testRealm, testClientId)
+					server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+				},
+				Config:      config,
+				ExpectError: regexp.MustCompile("client role tenant-reader already exists in client test-client in realm test, import it with the id test/test-client/tenant-reader"),
+			},
+			{
+				Config:             config,
+				ResourceName:       "embracecloud_client_role.role",
+				ImportState:        true,
+				ImportStateId:      testRealm + "/" + testClientId + "/tenant-reader",
+				ImportStatePersist: true,
+			},
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					func(s *terraform.State) error {
+						return resource.TestCheckResourceAttr("embracecloud_client_role.role", "client_uuid", recreated)(s)
+					},
+					testAccCheckClientRoleDescription(server, "tenant-reader", "can read"),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakClientRoleClientDiff_clientDeleted(t *testing.T) {
+	server := testKeycloak(t)
+	idOfClient := server.ClientUUID(testRealm, testClientId)
+	server.DeleteClient(testRealm, testClientId)
+
+	// what a plan with -refresh=false sees, the state still has the old client
+	state := &terraform.InstanceState{
+		ID: "tenant-reader",
+		Attributes: map[string]string{
+			"id":              "tenant-reader",
+			"realm_id":        testRealm,
+			"client_id":       testClientId,
+			"client_uuid":     idOfClient,
+			"name":            "tenant-reader",
+			"attributes_mode": attributesModeAuthoritative,
+		},
+	}
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"realm_id":  testRealm,
+		"client_id": testClientId,
+		"name":      "tenant-reader",
+	})
+
+	diff, err := resourceKeycloakClientRole().Diff(context.Background(), state, config, testProviderClient(server))
+	if err != nil {
+		t.Fatalf("expected a missing client to replace the role, got %v", err)
+	}
+	if !diff.RequiresNew() || !diff.Attributes["client_uuid"].NewComputed {
+		t.Errorf("expected the role to be replaced with an unknown client_uuid, got %v", diff)
+	}
+}
+
+func TestResourceKeycloakClientRoleClientDiff_newRole(t *testing.T) {
+	server := testKeycloak(t)
+	config := terraform.NewResourceConfigRaw(map[string]interface{}{
+		"realm_id":  testRealm,
+		"client_id": testClientId,
+		"name":      "tenant-reader",
+	})
+
+	// a role that does not exist yet has no client to lose
+	if _, err := resourceKeycloakClientRole().Diff(context.Background(), nil, config, testProviderClient(server)); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.RequestCount(http.MethodGet, "/clients$"); got != 0 {
+		t.Errorf("expected no client lookup when planning a new role, got %d", got)
+	}
+}
+
+func TestResourceKeycloakClientRoleRead_recreatedClient(t *testing.T) {
+	server := testKeycloak(t)
+	idOfClient := server.ClientUUID(testRealm, testClientId)
+	server.DeleteClient(testRealm, testClientId)
+	server.CreateClient(testRealm, testClientId)
+
+	data := schema.TestResourceDataRaw(t, resourceKeycloakClientRole().Schema, map[string]interface{}{
+		"realm_id":  testRealm,
+		"client_id": testClientId,
+		"name":      "tenant-reader",
+	})
+	data.SetId("tenant-reader")
+	data.Set("client_uuid", idOfClient)
+
+	diags := resourceKeycloakClientRoleRead(context.Background(), data, testProviderClient(server))
+	if len(diags) != 1 || diags[0].Severity != diag.Warning || diags[0].Summary != "client test-client in realm test was recreated" {
+		t.Errorf("expected a warning about the recreated client, got %v", diags)
+	}
+	if data.Id() != "" {
+		t.Errorf("expected the role to be removed from the state, got id %s", data.Id())
+	}
+}
+
+func TestResourceKeycloakClientRole_import(t *testing.T) {
+	server := testKeycloak(t)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckClientRoleDestroy(server, "tenant-reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testClientRoleConfig("tenant-reader", "can read", "tenant", "global"),
+			},
+			{
+				ResourceName:      "embracecloud_client_role.role",
+				ImportState:       true,
+				ImportStateId:     testRealm + "/" + testClientId + "/tenant-reader",
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName:  "embracecloud_client_role.role",
+				ImportState:   true,
+				ImportStateId: testRealm + "/" + testClientId + "/tenant-writer",
+				ExpectError:   regexp.MustCompile("no client role with name tenant-writer found in client test-client in realm test"),
+			},
+			{
+				ResourceName:  "embracecloud_client_role.role",
+				ImportState:   true,
+				ImportStateId: testRealm + "/other-client/tenant-reader",
+				ExpectError:   regexp.MustCompile("client other-client not found in realm test"),
+			},
+			{
+				ResourceName:  "embracecloud_client_role.role",
+				ImportState:   true,
+				ImportStateId: testRealm + "/tenant-reader",
+				ExpectError:   regexp.MustCompile("invalid import id test/tenant-reader"),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakClientRole_rename(t *testing.T) {
+	server := testKeycloak(t)
+	admin := server.CreateRealmRole(testRealm, "admin")
+	ops := server.CreateGroup(testRealm, "ops")
+	var id string
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckClientRoleDestroy(server, "tenant-reader", "tenant-viewer"),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testClientRoleConfig("tenant-reader", "can read", "tenant"),
+			},
+			{
+				// granted and nested in the admin console
+				PreConfig: func() {
+					id = *server.ClientRole(testRealm, testClientId, "tenant-reader").ID
+					server.AddComposite(testRealm, admin, id)
+					server.GrantRole(testRealm, ops, id)
+				},
+				Config: testProviderConfig(server) + testClientRoleConfig("tenant-viewer", "can read", "tenant"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_client_role.role", "id", "tenant-viewer"),
+					resource.TestCheckResourceAttr("embracecloud_client_role.role", "name", "tenant-viewer"),
+					func(s *terraform.State) error {
+						if server.ClientRole(testRealm, testClientId, "tenant-reader") != nil {
+							return fmt.Errorf("client role tenant-reader still exists")
+						}
+						if role := server.ClientRole(testRealm, testClientId, "tenant-viewer"); role == nil || *role.ID != id {
+							return fmt.Errorf("expected client role tenant-viewer to keep id %s, got %v", id, role)
+						}
+						if !server.HasRole(testRealm, ops, id) {
+							return fmt.Errorf("expected group ops to keep the renamed role")
+						}
+						return nil
+					},
+					testAccCheckRealmRoleComposites(server, "admin", "tenant-viewer"),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakClientRole_compositeRoles(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateRealmRole(testRealm, "reader")
+	server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	config := func(realmRoles string) string {
+		return testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_client_role" "role" {
+  realm_id  = %[1]q
+  client_id = %[2]q
+  name      = "tenant-admin"
+
+  composite_roles {
+    realm_roles = %[3]s
+    client_roles {
+      client_id = %[2]q
+      role_name = "tenant-reader"
+    }
+  }
+}
+`, testRealm, testClientId, realmRoles)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckClientRoleDestroy(server, "tenant-admin"),
+		Steps: []resource.TestStep{
+			{
+				Config: config(`["reader"]`),
+				Check:  testAccCheckClientRoleComposites(server, "tenant-admin", "reader", "tenant-reader"),
+			},
+			{
+				Config: config(`[]`),
+				Check:  testAccCheckClientRoleComposites(server, "tenant-admin", "tenant-reader"),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakClientRole_mergeAttributes(t *testing.T) {
+	server := testKeycloak(t)
+	config := func(scopes ...string) string {
+		return testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_client_role" "role" {
+  realm_id        = %q
+  client_id       = %q
+  name            = "tenant-reader"
+  attributes_mode = "merge"
+
+  attribute {
+    name   = "scope"
+    values = %s
+  }
+}
+`, testRealm, testClientId, testHclList(scopes))
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckClientRoleDestroy(server, "tenant-reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: config("tenant"),
+			},
+			{
+				PreConfig: func() {
+					role := server.ClientRole(testRealm, testClientId, "tenant-reader")
+					server.UpdateRole(testRealm, *role.ID, "", map[string][]string{"scope": {"tenant"}, "onboarding": {"done"}})
+				},
+				Config: config("tenant", "global"),
+				Check: func(s *terraform.State) error {
+					role := server.ClientRole(testRealm, testClientId, "tenant-reader")
+					if got := fmt.Sprint(*role.Attributes); got != "map[onboarding:[done] scope:[tenant global]]" {
+						return fmt.Errorf("unexpected attributes of client role tenant-reader %s", got)
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func testClientRoleConfig(name string, description string, scopes ...string) string {
+	return fmt.Sprintf(`
+resource "embracecloud_client_role" "role" {
+  realm_id    = %q
+  client_id   = %q
+  name        = %q
+  description = %q
+  attribute {
+    name   = "scope"
+    values = %s
+  }
+}
+`, testRealm, testClientId, name, description, testHclList(scopes))
+}
+
+func testAccCheckClientRoleDescription(server *keycloaktest.Server, name string, description string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		role := server.ClientRole(testRealm, testClientId, name)
+		if role == nil {
+			return fmt.Errorf("client role %s does not exist", name)
+		}
+		if *role.Description != description {
+			return fmt.Errorf("expected description %q of client role %s, got %q", description, name, *role.Description)
+		}
+		return nil
+	}
+}
+
+func testAccCheckClientRoleDestroy(server *keycloaktest.Server, names ...string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		for _, name := range names {
+			if server.ClientRole(testRealm, testClientId, name) != nil {
+				return fmt.Errorf("client role %s still exists", name)
+			}
+		}
+		return nil
+	}
+}
+
+func TestClientUUIDsCache(t *testing.T) {
+	server := testKeycloak(t)
+	other := server.CreateClient(testRealm, "other-client")
+	api := testKeycloakAPI(t, server)
+
+	ids, err := api.GetClientUUIDs(context.Background(), testRealm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{server.ClientUUID(testRealm, testClientId), other}; !reflect.DeepEqual(ids, expected) && !reflect.DeepEqual(ids, []string{expected[1], expected[0]}) {
+		t.Fatalf("expected the clients %v, got %v", expected, ids)
+	}
+
+	// the listed clients are not looked up again
+	idOfClient, err := api.GetClientUUID(context.Background(), testRealm, "other-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idOfClient != other {
+		t.Errorf("expected client %s, got %s", other, idOfClient)
+	}
+	if got := server.RequestCount(http.MethodGet, "/clients$"); got != 1 {
+		t.Errorf("expected the clients to be listed once, got %d requests", got)
+	}
+}
+
+func TestResourceKeycloakClientRole_createsShareClientLookup(t *testing.T) {
+	server := testKeycloak(t)
+	config := testProviderConfig(server)
+	for _, name := range []string{"tenant-reader", "tenant-writer", "tenant-admin", "tenant-auditor"} {
+		config += fmt.Sprintf(`
+resource "embracecloud_client_role" %[1]q {
+  realm_id  = %[2]q
+  client_id = %[3]q
+  name      = %[1]q
+}
+`, name, testRealm, testClientId)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckClientRoleDestroy(server, "tenant-reader", "tenant-writer", "tenant-admin", "tenant-auditor"),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check:  testAccCheckRequestCount(server, http.MethodGet, "/clients$", 1),
+			},
+		},
+	})
+}
+
+func TestClientUUIDCache(t *testing.T) {
+	server := testKeycloak(t)
+	api := testKeycloakAPI(t, server)
+
+	var wg sync.WaitGroup
+	ids := make([]string, 10)
+	errs := make([]error, 10)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i], errs[i] = api.GetClientUUID(context.Background(), testRealm, testClientId)
+		}(i)
+	}
+	wg.Wait()
+	idOfClient := ids[0]
+	for i := range ids {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if ids[i] != idOfClient {
+			t.Fatalf("expected every lookup to return %s, got %s", idOfClient, ids[i])
+		}
+	}
+	if got := server.RequestCount(http.MethodGet, "/clients$"); got != 1 {
+		t.Fatalf("expected the client to be looked up once, got %d lookups", got)
+	}
+
+	// a missing role of the client says nothing about the client
+	if _, err := api.GetClientRole(context.Background(), testRealm, idOfClient, "missing-role"); err == nil {
+		t.Fatal("expected the role to be missing")
+	}
+	if _, err := api.GetClientUUID(context.Background(), testRealm, testClientId); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.RequestCount(http.MethodGet, "/clients$"); got != 1 {
+		t.Fatalf("expected the client to stay cached after a missing role, got %d lookups", got)
+	}
+
+	// a client that is recreated gets a new id, the 404 for the old one drops
+	// it from the cache
+	server.DeleteClient(testRealm, testClientId)
+	recreated := server.CreateClient(testRealm, testClientId)
+	if _, err := api.GetClientRoles(context.Background(), testRealm, idOfClient, gocloak.GetRoleParams{}); err == nil {
+		t.Fatal("expected the roles of the deleted client to be missing")
+	}
+	idOfClient, err := api.GetClientUUID(context.Background(), testRealm, testClientId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idOfClient != recreated {
+		t.Errorf("expected the recreated client %s to be looked up, got %s", recreated, idOfClient)
+	}
+
+	if _, err := api.GetClientUUID(context.Background(), testRealm, "missing-client"); err == nil || !strings.Contains(err.Error(), "client missing-client not found in realm test") {
+		t.Errorf("expected a missing client error, got %v", err)
+	}
+}
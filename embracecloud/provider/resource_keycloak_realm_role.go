@@ -17,10 +17,51 @@ func resourceKeycloakRealmRole() *schema.Resource {
 		ReadContext:   resourceKeycloakRealmRoleRead,
 		DeleteContext: resourceKeycloakRealmRoleDelete,
 		UpdateContext: resourceKeycloakRealmRoleUpdate,
-		// This resource can be imported using {{realm}}/{{roleId}}. The role's ID (a GUID) can be found in the URL when viewing the role
+		// This resource can be imported using {{realm}}/{{roleName}} or {{realm}}/{{roleId}}. The role's ID (a GUID) can be found in the URL when viewing the role
 		Importer: &schema.ResourceImporter{
 			StateContext: resourceKeycloakRealmRoleImport,
 		},
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceKeycloakRealmRoleV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceKeycloakRoleStateUpgradeV0,
+			},
+		},
+		Schema: map[string]*schema.Schema{
+			"realm_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			// renaming keeps the role, its id and everything that refers to it
+			"name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"keycloak_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+				ForceNew: false,
+			},
+			"description": {
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			// misc attributes
+			"attribute":       attributeSchema(),
+			"attributes":      attributesSchema(),
+			"attributes_mode": attributesModeSchema(),
+			"composite_roles": compositeRolesSchema(),
+		},
+	}
+}
+
+// resourceKeycloakRealmRoleV0 is the schema of state version 0, in which the
+// values of an attribute were joined with MULTIVALUE_ATTRIBUTE_SEPARATOR
+func resourceKeycloakRealmRoleV0() *schema.Resource {
+	return &schema.Resource{
 		Schema: map[string]*schema.Schema{
 			"realm_id": {
 				Type:     schema.TypeString,
@@ -46,18 +87,14 @@ func resourceKeycloakRealmRole() *schema.Resource {
 				Type:     schema.TypeMap,
 				Optional: true,
 			},
+			"composite_roles": compositeRolesSchema(),
 		},
 	}
 }
 
 func mapRole(data *schema.ResourceData) (rl gocloak.Role, realm string) {
 
-	attributes := map[string][]string{}
-	if v, ok := data.GetOk("attributes"); ok {
-		for key, value := range v.(map[string]interface{}) {
-			attributes[key] = strings.Split(value.(string), MULTIVALUE_ATTRIBUTE_SEPARATOR)
-		}
-	}
+	attributes := roleAttributes(data.Get("attribute"), data.Get("attributes"))
 
 	role := gocloak.Role{
 		ID:          gocloak.StringP(data.Id()),
@@ -69,25 +106,22 @@ func mapRole(data *schema.ResourceData) (rl gocloak.Role, realm string) {
 }
 
 func mapFromRoleToData(data *schema.ResourceData, role gocloak.Role) {
-	attributes := map[string]string{}
-	for k, v := range *role.Attributes {
-		attributes[k] =
-			strings.Join(v, MULTIVALUE_ATTRIBUTE_SEPARATOR)
-	}
-
 	data.Set("realm_id", data.Get("realm_id").(string))
 	data.Set("name", role.Name)
 	data.Set("description", role.Description)
-	data.Set("attributes", attributes)
+	setRoleAttributes(data, managedRoleAttributes(data, role.Attributes))
 	data.Set("keycloak_id", role.ID)
 }
 
 func resourceKeycloakRealmRoleCreate(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	role, realm := mapRole(data)
 
-	id, err := keycloakCLient.CreateRealmRole(ctx, token.AccessToken, realm,
+	id, err := keycloakCLient.CreateRealmRole(ctx, realm,
 		role)
 
 	if err != nil {
@@ -96,24 +130,37 @@ func resourceKeycloakRealmRoleCreate(ctx context.Context, data *schema.ResourceD
 
 	data.SetId(id)
 
+	if _, ok := data.GetOk("composite_roles"); ok {
+		if diags := resourceKeycloakRealmRoleApplyCompositeRoles(ctx, keycloakCLient, data); diags.HasError() {
+			return diags
+		}
+	}
+
 	return resourceKeycloakRealmRoleRead(ctx, data, meta)
 
 }
 
 func resourceKeycloakRealmRoleRead(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 
-	role, err := keycloakCLient.GetRealmRole(ctx, token.AccessToken, data.Get("realm_id").(string), data.Id())
+	role, err := keycloakCLient.GetRealmRole(ctx, data.Get("realm_id").(string), data.Id())
 	if err != nil {
-		if strings.Contains(err.Error(), "404") {
+		if embracecloud.IsNotFound(err) {
 			data.SetId("")
 		} else {
-			return diag.Errorf(fmt.Sprint("failed to get realm role error -> %s"), err.Error())
+			return diag.Errorf("failed to get realm role error -> %s", err.Error())
 		}
 
 	} else {
 		mapFromRoleToData(data, *role)
+
+		if err := readInlineCompositeRoles(ctx, keycloakCLient, data, data.Get("realm_id").(string), *role.ID); err != nil {
+			return diag.Errorf("could not get composites of realm role %s error -> %s", data.Id(), err.Error())
+		}
 	}
 
 	return nil
@@ -121,23 +168,75 @@ func resourceKeycloakRealmRoleRead(ctx context.Context, data *schema.ResourceDat
 
 func resourceKeycloakRealmRoleUpdate(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	role, realm := mapRole(data)
 
-	err := keycloakCLient.UpdateRealmRole(ctx, token.AccessToken, realm, *role.ID, role)
+	merge := data.Get("attributes_mode").(string) == attributesModeMerge
+	var current *gocloak.Role
+	if merge || data.HasChange("name") {
+		current, err = keycloakCLient.GetRealmRole(ctx, realm, data.Id())
+		if err != nil {
+			return diag.Errorf("failed to get realm role error -> %s", err.Error())
+		}
+	}
+	if merge {
+		attributes := mergeRoleAttributes(data, current.Attributes)
+		role.Attributes = &attributes
+	}
+
+	// renames go through the id like for client roles
+	if data.HasChange("name") {
+		role.ID = current.ID
+		err = keycloakCLient.UpdateRoleByID(ctx, realm, *current.ID, role)
+	} else {
+		err = keycloakCLient.UpdateRealmRole(ctx, realm, data.Id(), role)
+	}
 
 	if err != nil {
 		return diag.Errorf(fmt.Sprintf("could not update realm role %s in realm %s error -> %s", *role.Name, realm, err.Error()))
 	}
 
-	return resourceKeycloakRealmRoleRead(ctx, data, meta)
+	var warnings diag.Diagnostics
+	if data.HasChange("name") {
+		data.SetId(*role.Name)
+		oldName, _ := data.GetChange("name")
+		warnings = roleRenameWarnings(ctx, keycloakCLient, realm, "", oldName.(string), *role.Name)
+	}
+
+	if data.HasChange("composite_roles") {
+		if diags := resourceKeycloakRealmRoleApplyCompositeRoles(ctx, keycloakCLient, data); diags.HasError() {
+			return diags
+		}
+	}
+
+	return append(warnings, resourceKeycloakRealmRoleRead(ctx, data, meta)...)
+}
+
+func resourceKeycloakRealmRoleApplyCompositeRoles(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, data *schema.ResourceData) diag.Diagnostics {
+	realm := data.Get("realm_id").(string)
+
+	role, err := keycloakCLient.GetRealmRole(ctx, realm, data.Id())
+	if err != nil {
+		return diag.Errorf("failed to get realm role error -> %s", err.Error())
+	}
+
+	if err := applyInlineCompositeRoles(ctx, keycloakCLient, data, realm, *role.ID); err != nil {
+		return diag.Errorf("could not set composites of realm role %s in realm %s error -> %s", *role.Name, realm, err.Error())
+	}
+	return nil
 }
 
 func resourceKeycloakRealmRoleDelete(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	role, realm := mapRole(data)
-	err := keycloakCLient.DeleteRealmRole(ctx, token.AccessToken, realm, *role.ID)
+	err = keycloakCLient.DeleteRealmRole(ctx, realm, *role.ID)
 	if err != nil {
 		return diag.Errorf(fmt.Sprintf("could not delete realm role %s in realm %s error -> %s", *role.Name, realm, err.Error()))
 	}
@@ -145,6 +244,33 @@ func resourceKeycloakRealmRoleDelete(ctx context.Context, data *schema.ResourceD
 }
 
 func resourceKeycloakRealmRoleImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.SplitN(d.Id(), "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid import id %s, expected {{realm}}/{{roleName}} or {{realm}}/{{roleId}}", d.Id())
+	}
+	realm, nameOrId := parts[0], parts[1]
+
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := keycloakCLient.GetRealmRole(ctx, realm, nameOrId)
+	if err != nil && embracecloud.IsNotFound(err) {
+		role, err = keycloakCLient.GetRealmRoleByID(ctx, realm, nameOrId)
+	}
+	if err != nil {
+		if embracecloud.IsNotFound(err) {
+			return nil, fmt.Errorf("no realm role with name or id %s found in realm %s", nameOrId, realm)
+		}
+		return nil, fmt.Errorf("failed to get realm role %s in realm %s error -> %s", nameOrId, realm, err.Error())
+	}
+
+	// the resource is identified by the role name, not by the keycloak id
+	d.SetId(*role.Name)
+	d.Set("realm_id", realm)
+	mapFromRoleToData(d, *role)
 
 	return []*schema.ResourceData{d}, nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strings"
+
 	"github.com/Nerzal/gocloak/v12"
 	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
@@ -15,9 +16,50 @@ func resourceKeycloakRealmRoleComposite() *schema.Resource {
 		CreateContext: resourceKeycloakRealmRoleCompositeCreate,
 		ReadContext:   resourceKeycloakRealmRoleCompositeRead,
 		DeleteContext: resourceKeycloakRealmRoleCompositeDelete,
+		// This resource can be imported using {{realm}}//{{parentRoleName}}/{{compositeClientId}}/{{compositeRoleName}},
+		// with {{compositeClientId}} left empty when the composite is a realm role
 		Importer: &schema.ResourceImporter{
 			StateContext: resourceKeycloakRealmRoleCompositeImport,
 		},
+		SchemaVersion: 1,
+		StateUpgraders: []schema.StateUpgrader{
+			{
+				Version: 0,
+				Type:    resourceKeycloakRealmRoleCompositeV0().CoreConfigSchema().ImpliedType(),
+				Upgrade: resourceKeycloakRealmRoleCompositeStateUpgradeV0,
+			},
+		},
+		Schema: map[string]*schema.Schema{
+			"realm_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"parent_role_name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+
+			"composite_client_id": {
+				Type:     schema.TypeString,
+				Optional: true,
+				ForceNew: true,
+			},
+
+			"composite_role_name": {
+				Type:     schema.TypeString,
+				ForceNew: true,
+				Required: true,
+			},
+		},
+	}
+}
+
+// resourceKeycloakRealmRoleCompositeV0 is the schema of state version 0, in
+// which the id was the parent role name. The attributes are unchanged.
+func resourceKeycloakRealmRoleCompositeV0() *schema.Resource {
+	return &schema.Resource{
 		Schema: map[string]*schema.Schema{
 			"realm_id": {
 				Type:     schema.TypeString,
@@ -47,13 +89,16 @@ func resourceKeycloakRealmRoleComposite() *schema.Resource {
 
 func resourceKeycloakRealmRoleCompositeCreate(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	realm := data.Get("realm_id").(string)
 	role_name := data.Get("parent_role_name").(string)
 	composite_client_id, isClient := data.GetOkExists("composite_client_id")
 	composteRoleName := data.Get("composite_role_name").(string)
 
-	role, err := keycloakCLient.GetRealmRole(ctx, token.AccessToken, realm, role_name)
+	role, err := keycloakCLient.GetRealmRole(ctx, realm, role_name)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -62,53 +107,37 @@ func resourceKeycloakRealmRoleCompositeCreate(ctx context.Context, data *schema.
 
 	if isClient == true {
 		var clientId = composite_client_id.(string)
-		var params = gocloak.GetClientsParams{
-			ClientID: &clientId,
-		}
-
-		clients, err := keycloakCLient.GetClients(ctx, token.AccessToken, realm, params)
-
+		idOfClient, err := keycloakCLient.GetClientUUID(ctx, realm, clientId)
 		if err != nil {
-			return diag.Errorf(fmt.Sprintf("cannot find client %s in realm %s", clientId, realm))
-		}
-		if len(clients) < 1 {
-			return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s", clientId, realm))
-		}
-
-		if len(clients) > 1 {
-			return diag.Errorf("multiple clients found")
+			return diag.FromErr(err)
 		}
 
-		res, err := keycloakCLient.GetClient(ctx, token.AccessToken, realm, *clients[0].ID)
+		compRoleResponse, err := keycloakCLient.GetClientRole(ctx, realm, idOfClient, composteRoleName)
 		if err != nil {
-			return diag.Errorf(fmt.Sprintf("cannot find client %s in realm %s", clientId, realm))
-		}
-		compRoleResponse, err := keycloakCLient.GetClientRole(ctx, token.AccessToken, realm, *res.ID, composteRoleName)
-		if err != nil {
-			return diag.Errorf(fmt.Sprintf("Could not find client role in client %s with name %s in realm %s error -> %s", *res.ID, composteRoleName, realm, err.Error()))
+			return diag.Errorf(fmt.Sprintf("Could not find client role in client %s with name %s in realm %s error -> %s", clientId, composteRoleName, realm, err.Error()))
 		}
 
 		compRole = append(compRole, *compRoleResponse)
 
-		err = keycloakCLient.AddClientRoleComposite(ctx, token.AccessToken, realm, *role.ID, compRole)
+		err = keycloakCLient.AddClientRoleComposite(ctx, realm, *role.ID, compRole)
 		if err != nil {
 			return diag.Errorf(fmt.Sprintf("Cannot add composite client role %s from client %s in realm %s error -> %s", *compRole[0].Name, clientId, realm, err.Error()))
 		}
 
 	} else {
-		compRoleResponse, err := keycloakCLient.GetRealmRole(ctx, token.AccessToken, realm, composteRoleName)
+		compRoleResponse, err := keycloakCLient.GetRealmRole(ctx, realm, composteRoleName)
 		if err != nil {
 			return diag.Errorf(fmt.Sprintf("Could not find realm role %s in realm %s error -> %s", composteRoleName, realm, err.Error()))
 		}
 
 		compRole = append(compRole, *compRoleResponse)
-		err = keycloakCLient.AddRealmRoleComposite(ctx, token.AccessToken, data.Get("realm_id").(string), *role.Name, compRole)
+		err = keycloakCLient.AddRealmRoleComposite(ctx, data.Get("realm_id").(string), *role.Name, compRole)
 		if err != nil {
 			return diag.Errorf(fmt.Sprintf("Cannot add composite %s to realmrole %s in realm %s error -> %s", *compRole[0].Name, *role.Name, realm, err.Error()))
 		}
 	}
 
-	data.SetId(role_name)
+	data.SetId(compositeId(realm, "", role_name, data.Get("composite_client_id").(string), composteRoleName))
 
 	return nil
 
@@ -116,35 +145,79 @@ func resourceKeycloakRealmRoleCompositeCreate(ctx context.Context, data *schema.
 
 func resourceKeycloakRealmRoleCompositeRead(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakClient, token := client.GetKeycloakClient()
+	keycloakClient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	realm := data.Get("realm_id").(string)
 	roleName := data.Get("parent_role_name").(string)
+	compositeClientId := data.Get("composite_client_id").(string)
 	compositeRoleName := data.Get("composite_role_name").(string)
 
-	role, err := keycloakClient.GetRealmRole(ctx, token.AccessToken, realm, roleName)
+	// the composite went away with either role or the client of the composite
+	role, err := getRole(ctx, keycloakClient, realm, "", roleName)
 	if err != nil {
-		return diag.Errorf("Parent role %s not found in realm %s.", roleName, realm)
+		if embracecloud.IsNotFound(err) {
+			data.SetId("")
+			return nil
+		}
+		return diag.FromErr(err)
 	}
 
-	compRole, err := keycloakClient.GetRealmRole(ctx, token.AccessToken, realm, compositeRoleName)
+	compRole, err := getRole(ctx, keycloakClient, realm, compositeClientId, compositeRoleName)
 	if err != nil {
-		data.SetId("") 
+		if embracecloud.IsNotFound(err) {
+			data.SetId("")
+			return nil
+		}
+		return diag.FromErr(err)
+	}
 
+	found, err := hasComposite(ctx, keycloakClient, realm, *role.ID, *compRole.ID)
+	if err != nil {
+		return diag.Errorf("could not get composites of realm role %s in realm %s error -> %s", roleName, realm, err.Error())
+	}
+	if !found {
+		// the composite was removed outside terraform
+		data.SetId("")
 	}
 
 	return nil
 }
 
+// hasComposite reports whether the role with id childId is a direct composite
+// of the role with id parentId, parents and children can be realm or client roles
+func hasComposite(ctx context.Context, keycloakClient embracecloud.KeycloakAPI, realm string, parentId string, childId string) (bool, error) {
+	composites, err := keycloakClient.GetCompositeRolesByRoleID(ctx, realm, parentId)
+	if err != nil {
+		return false, err
+	}
+
+	for _, composite := range composites {
+		if gocloak.PString(composite.ID) == childId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
 func resourceKeycloakRealmRoleCompositeDelete(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	realm := data.Get("realm_id").(string)
 	role_name := data.Get("parent_role_name").(string)
 	composite_client_id, isClient := data.GetOkExists("composite_client_id")
 	composteRoleName := data.Get("composite_role_name").(string)
 
-	role, err := keycloakCLient.GetRealmRole(ctx, token.AccessToken, realm, role_name)
+	role, err := keycloakCLient.GetRealmRole(ctx, realm, role_name)
 	if err != nil {
+		if embracecloud.IsNotFound(err) {
+			// the parent role is already removed outside terraform, so is the composite
+			return nil
+		}
 		return diag.FromErr(err)
 	}
 
@@ -152,48 +225,44 @@ func resourceKeycloakRealmRoleCompositeDelete(ctx context.Context, data *schema.
 
 	if isClient == true {
 		var clientId = composite_client_id.(string)
-		var params = gocloak.GetClientsParams{
-			ClientID: &clientId,
-		}
-
-		clients, err := keycloakCLient.GetClients(ctx, token.AccessToken, realm, params)
-
+		idOfClient, err := keycloakCLient.GetClientUUID(ctx, realm, clientId)
 		if err != nil {
-			return diag.Errorf(fmt.Sprintf("cannot find client %s in realm %s", clientId, realm))
-		}
-		if len(clients) < 1 {
-			return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s", clientId, realm))
-		}
-
-		if len(clients) > 1 {
-			return diag.Errorf("multiple clients found")
+			if embracecloud.IsNotFound(err) {
+				// the client is already removed outside terraform, so is its role
+				return nil
+			}
+			return diag.FromErr(err)
 		}
 
-		compRoleResponse, err := keycloakCLient.GetClientRole(ctx, token.AccessToken, realm, *clients[0].ID, composteRoleName)
+		compRoleResponse, err := keycloakCLient.GetClientRole(ctx, realm, idOfClient, composteRoleName)
 		if err != nil {
-			if strings.Contains(err.Error(), "404") {
+			if embracecloud.IsNotFound(err) {
 				//client role is already removed outside terraform logic the composite cannot exist so we delete the resource
 				return nil
 			}
-			
+
 			return diag.Errorf(fmt.Sprintf("Could not find client role in client %s with name %s in realm %s error -> %s", clientId, composteRoleName, realm, err.Error()))
 		}
 
 		compRole = append(compRole, *compRoleResponse)
 
-		err = keycloakCLient.DeleteClientRoleComposite(ctx, token.AccessToken, realm, *role.ID, compRole)
+		err = keycloakCLient.DeleteClientRoleComposite(ctx, realm, *role.ID, compRole)
 		if err != nil {
 			return diag.Errorf(fmt.Sprintf("Cannot delete composite client role %s from client %s in realm %s error -> %s", *compRole[0].Name, clientId, realm, err.Error()))
 		}
 
 	} else {
-		compRoleResponse, err := keycloakCLient.GetRealmRole(ctx, token.AccessToken, realm, composteRoleName)
+		compRoleResponse, err := keycloakCLient.GetRealmRole(ctx, realm, composteRoleName)
 		if err != nil {
+			if embracecloud.IsNotFound(err) {
+				// realm role is already removed outside terraform, the composite cannot exist
+				return nil
+			}
 			return diag.Errorf(fmt.Sprintf("Could not find realm role %s in realm %s error -> %s", composteRoleName, realm, err.Error()))
 		}
 
 		compRole = append(compRole, *compRoleResponse)
-		err = keycloakCLient.DeleteRealmRoleComposite(ctx, token.AccessToken, realm, *role.Name, compRole)
+		err = keycloakCLient.DeleteRealmRoleComposite(ctx, realm, *role.Name, compRole)
 		if err != nil {
 			return diag.Errorf(fmt.Sprintf("Could not delete composite role %s from realmrole %s in realm %s error -> %s", *compRole[0].Name, *role.Name, realm, err.Error()))
 
@@ -203,6 +272,50 @@ func resourceKeycloakRealmRoleCompositeDelete(ctx context.Context, data *schema.
 }
 
 func resourceKeycloakRealmRoleCompositeImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	realm, parentClientId, parentRoleName, compositeClientId, compositeRoleName, err := parseCompositeId(d.Id())
+	if err != nil {
+		return nil, err
+	}
+	if parentClientId != "" {
+		return nil, fmt.Errorf("invalid import id %s, the parent of a realm role composite must be a realm role, use embracecloud_client_role_composite for client roles", d.Id())
+	}
+
+	d.Set("realm_id", realm)
+	d.Set("parent_role_name", parentRoleName)
+	if compositeClientId != "" {
+		d.Set("composite_client_id", compositeClientId)
+	}
+	d.Set("composite_role_name", compositeRoleName)
 
 	return []*schema.ResourceData{d}, nil
 }
+
+func resourceKeycloakRealmRoleCompositeStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	compositeClientId, _ := rawState["composite_client_id"].(string)
+	rawState["id"] = compositeId(rawState["realm_id"].(string), "", rawState["parent_role_name"].(string), compositeClientId, rawState["composite_role_name"].(string))
+
+	return rawState, nil
+}
+
+// compositeId builds the id of a composite resource,
+// {{realm}}/{{parentClientId}}/{{parentRoleName}}/{{compositeClientId}}/{{compositeRoleName}}.
+// An empty client id stands for a realm role and leaves its part empty, no
+// client id can be mistaken for it.
+func compositeId(realm string, parentClientId string, parentRoleName string, compositeClientId string, compositeRoleName string) string {
+	return strings.Join([]string{realm, parentClientId, parentRoleName, compositeClientId, compositeRoleName}, "/")
+}
+
+// parseCompositeId splits an id built by compositeId, the client ids of realm
+// roles are returned empty
+func parseCompositeId(id string) (realm string, parentClientId string, parentRoleName string, compositeClientId string, compositeRoleName string, err error) {
+	parts := strings.Split(id, "/")
+	if len(parts) != 5 {
+		return "", "", "", "", "", fmt.Errorf("invalid composite id %s, expected {{realm}}/{{parentClientId}}/{{parentRoleName}}/{{compositeClientId}}/{{compositeRoleName}} with the client id left empty for realm roles", id)
+	}
+
+	realm, parentClientId, parentRoleName, compositeClientId, compositeRoleName = parts[0], parts[1], parts[2], parts[3], parts[4]
+	if realm == "" || parentRoleName == "" || compositeRoleName == "" {
+		return "", "", "", "", "", fmt.Errorf("invalid composite id %s, only the client ids may be empty", id)
+	}
+	return realm, parentClientId, parentRoleName, compositeClientId, compositeRoleName, nil
+}
@@ -0,0 +1,294 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceKeycloakRealmRoleComposite_basic(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateRealmRole(testRealm, "admin")
+	server.CreateRealmRole(testRealm, "reader")
+	server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckCompositesDestroy(server, testRealmRoleId(server, "admin")),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_realm_role_composite" "realm" {
+  realm_id            = %[1]q
+  parent_role_name    = "admin"
+  composite_role_name = "reader"
+}
+
+resource "embracecloud_realm_role_composite" "client" {
+  realm_id            = %[1]q
+  parent_role_name    = "admin"
+  composite_client_id = %[2]q
+  composite_role_name = "tenant-reader"
+}
+`, testRealm, testClientId),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_realm_role_composite.realm", "id", "test//admin//reader"),
+					resource.TestCheckResourceAttr("embracecloud_realm_role_composite.client", "id", "test//admin/test-client/tenant-reader"),
+					testAccCheckComposites(server, testRealmRoleId(server, "admin"), "reader", "tenant-reader"),
+				),
+			},
+			{
+				ResourceName:      "embracecloud_realm_role_composite.realm",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName:      "embracecloud_realm_role_composite.client",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName:  "embracecloud_realm_role_composite.realm",
+				ImportState:   true,
+				ImportStateId: "test//admin//writer",
+				ExpectError:   regexp.MustCompile("Cannot import non-existent remote object"),
+			},
+			{
+				ResourceName:  "embracecloud_realm_role_composite.realm",
+				ImportState:   true,
+				ImportStateId: "test/test-client/tenant-admin//reader",
+				ExpectError:   regexp.MustCompile("use embracecloud_client_role_composite for client roles"),
+			},
+			{
+				ResourceName:  "embracecloud_realm_role_composite.realm",
+				ImportState:   true,
+				ImportStateId: "admin",
+				ExpectError:   regexp.MustCompile("invalid composite id admin"),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRealmRoleComposite_drift(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateRealmRole(testRealm, "admin")
+	config := testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_realm_role" "reader" {
+  realm_id = %[1]q
+  name     = "reader"
+}
+
+resource "embracecloud_realm_role_composite" "realm" {
+  realm_id            = %[1]q
+  parent_role_name    = "admin"
+  composite_role_name = embracecloud_realm_role.reader.name
+}
+`, testRealm)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckCompositesDestroy(server, testRealmRoleId(server, "admin")),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check:  testAccCheckComposites(server, testRealmRoleId(server, "admin"), "reader"),
+			},
+			{
+				// composite removed from the parent in the admin console
+				PreConfig: func() {
+					server.RemoveComposite(testRealm, testRealmRoleId(server, "admin"), testRealmRoleId(server, "reader"))
+				},
+				Config: config,
+				Check:  testAccCheckComposites(server, testRealmRoleId(server, "admin"), "reader"),
+			},
+			{
+				// composite role deleted in the admin console
+				PreConfig: func() {
+					server.DeleteRole(testRealm, testRealmRoleId(server, "reader"))
+				},
+				Config: config,
+				Check:  testAccCheckComposites(server, testRealmRoleId(server, "admin"), "reader"),
+			},
+			{
+				// parent role deleted in the admin console
+				PreConfig: func() {
+					server.DeleteRole(testRealm, testRealmRoleId(server, "admin"))
+				},
+				Config:             config,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRealmRoleCompositeDelete_goneOutsideTerraform(t *testing.T) {
+	cases := map[string]struct {
+		compositeClientId string
+		gone              func(server *keycloaktest.Server, admin string, reader string)
+	}{
+		"parent role": {
+			gone: func(server *keycloaktest.Server, admin string, reader string) { server.DeleteRole(testRealm, admin) },
+		},
+		"realm role": {
+			gone: func(server *keycloaktest.Server, admin string, reader string) { server.DeleteRole(testRealm, reader) },
+		},
+		"client role": {
+			compositeClientId: testClientId,
+			gone:              func(server *keycloaktest.Server, admin string, reader string) { server.DeleteRole(testRealm, reader) },
+		},
+		"client": {
+			compositeClientId: testClientId,
+			gone: func(server *keycloaktest.Server, admin string, reader string) {
+				server.DeleteClient(testRealm, testClientId)
+			},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			server := testKeycloak(t)
+			admin := server.CreateRealmRole(testRealm, "admin")
+			reader := server.CreateRealmRole(testRealm, "reader")
+			if c.compositeClientId != "" {
+				reader = server.CreateClientRole(testRealm, c.compositeClientId, "reader")
+			}
+			server.AddComposite(testRealm, admin, reader)
+
+			raw := map[string]interface{}{
+				"realm_id":            testRealm,
+				"parent_role_name":    "admin",
+				"composite_role_name": "reader",
+			}
+			if c.compositeClientId != "" {
+				raw["composite_client_id"] = c.compositeClientId
+			}
+			data := schema.TestResourceDataRaw(t, resourceKeycloakRealmRoleComposite().Schema, raw)
+			data.SetId(compositeId(testRealm, "", "admin", c.compositeClientId, "reader"))
+
+			c.gone(server, admin, reader)
+			if diags := resourceKeycloakRealmRoleCompositeDelete(context.Background(), data, testProviderClient(server)); diags.HasError() {
+				t.Fatalf("expected nothing left to delete, got %v", diags)
+			}
+		})
+	}
+}
+
+func TestResourceKeycloakRealmRoleCompositeStateUpgradeV0(t *testing.T) {
+	cases := []struct {
+		state map[string]interface{}
+		id    string
+	}{
+		{
+			state: map[string]interface{}{
+				"id":                  "admin",
+				"realm_id":            "test",
+				"parent_role_name":    "admin",
+				"composite_role_name": "reader",
+			},
+			id: "test//admin//reader",
+		},
+		{
+			state: map[string]interface{}{
+				"id":                  "admin",
+				"realm_id":            "test",
+				"parent_role_name":    "admin",
+				"composite_client_id": "test-client",
+				"composite_role_name": "tenant-reader",
+			},
+			id: "test//admin/test-client/tenant-reader",
+		},
+	}
+
+	for _, c := range cases {
+		state, err := resourceKeycloakRealmRoleCompositeStateUpgradeV0(context.Background(), c.state, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state["id"] != c.id {
+			t.Errorf("expected id %s, got %s", c.id, state["id"])
+		}
+	}
+}
+
+func TestParseCompositeId(t *testing.T) {
+	for _, parts := range [][]string{
+		{"test", "", "admin", "test-client", "tenant-reader"},
+		{"test", "test-client", "tenant-admin", "", "reader"},
+		// a client may be called realm without being taken for the realm
+		{"test", "realm", "tenant-admin", "realm", "tenant-reader"},
+	} {
+		realm, parentClientId, parentRoleName, compositeClientId, compositeRoleName, err := parseCompositeId(compositeId(parts[0], parts[1], parts[2], parts[3], parts[4]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := []string{realm, parentClientId, parentRoleName, compositeClientId, compositeRoleName}; !reflect.DeepEqual(got, parts) {
+			t.Errorf("expected %v, got %v", parts, got)
+		}
+	}
+
+	for _, id := range []string{"admin", "test//admin/reader", "test////reader", "/realm/admin//reader", "test//admin//", "test//admin//reader/extra"} {
+		if _, _, _, _, _, err := parseCompositeId(id); err == nil {
+			t.Errorf("expected an error for id %s", id)
+		}
+	}
+}
+
+func testRealmRoleId(server *keycloaktest.Server, name string) string {
+	return *server.RealmRole(testRealm, name).ID
+}
+
+func testClientRoleId(server *keycloaktest.Server, name string) string {
+	return *server.ClientRole(testRealm, testClientId, name).ID
+}
+
+// testAccCheckComposites checks the role with parentId has exactly the
+// composites with the given names
+func testAccCheckComposites(server *keycloaktest.Server, parentId string, names ...string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		composites := server.Composites(testRealm, parentId)
+
+		var got []string
+		for _, composite := range composites {
+			got = append(got, *composite.Name)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(names) {
+			return fmt.Errorf("expected composites %v, got %v", names, got)
+		}
+		return nil
+	}
+}
+
+// testAccCheckRealmRoleComposites is testAccCheckComposites for a realm role
+// that terraform creates, it is looked up when the check runs
+func testAccCheckRealmRoleComposites(server *keycloaktest.Server, name string, names ...string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		return testAccCheckComposites(server, testRealmRoleId(server, name), names...)(s)
+	}
+}
+
+// testAccCheckClientRoleComposites is testAccCheckComposites for a client role
+// that terraform creates, it is looked up when the check runs
+func testAccCheckClientRoleComposites(server *keycloaktest.Server, name string, names ...string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		return testAccCheckComposites(server, testClientRoleId(server, name), names...)(s)
+	}
+}
+
+func testAccCheckCompositesDestroy(server *keycloaktest.Server, parentId string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if composites := server.Composites(testRealm, parentId); len(composites) > 0 {
+			return fmt.Errorf("role %s still has %d composites", parentId, len(composites))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,577 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceKeycloakRealmRole_basic(t *testing.T) {
+	server := testKeycloak(t)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckRealmRoleDestroy(server, "reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testRealmRoleConfig("reader", "can read", "tenant"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "id", "reader"),
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "realm_id", testRealm),
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "description", "can read"),
+					resource.TestCheckTypeSetElemNestedAttrs("embracecloud_realm_role.role", "attribute.*", map[string]string{"name": "scope", "values.#": "1", "values.0": "tenant"}),
+					resource.TestCheckResourceAttrSet("embracecloud_realm_role.role", "keycloak_id"),
+					testAccCheckRealmRoleDescription(server, "reader", "can read"),
+				),
+			},
+			{
+				Config: testProviderConfig(server) + testRealmRoleConfig("reader", "can read everything", "tenant", "global"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "description", "can read everything"),
+					resource.TestCheckTypeSetElemNestedAttrs("embracecloud_realm_role.role", "attribute.*", map[string]string{"name": "scope", "values.#": "2", "values.0": "tenant", "values.1": "global"}),
+					testAccCheckRealmRoleDescription(server, "reader", "can read everything"),
+					testAccCheckRealmRoleAttribute(server, "reader", "scope", []string{"tenant", "global"}),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRealmRole_attributeValues(t *testing.T) {
+	server := testKeycloak(t)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckRealmRoleDestroy(server, "reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testRealmRoleConfig("reader", "can read", "a##b", "", "c"),
+				Check:  testAccCheckRealmRoleAttribute(server, "reader", "scope", []string{"a##b", "", "c"}),
+			},
+			{
+				// changed in the admin console
+				PreConfig: func() {
+					role := server.RealmRole(testRealm, "reader")
+					server.UpdateRole(testRealm, *role.ID, "can read", map[string][]string{"scope": {"a", "b"}, "tier": {"gold"}})
+				},
+				Config: testProviderConfig(server) + testRealmRoleConfig("reader", "can read", "a##b", "", "c"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckRealmRoleAttribute(server, "reader", "scope", []string{"a##b", "", "c"}),
+					testAccCheckRealmRoleAttribute(server, "reader", "tier", nil),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRealmRole_deprecatedAttributes(t *testing.T) {
+	server := testKeycloak(t)
+	config := func(attributes string) string {
+		return testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_realm_role" "role" {
+  realm_id = %q
+  name     = "reader"
+%s
+}
+`, testRealm, attributes)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckRealmRoleDestroy(server, "reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: config(`
+  attributes = {
+    scope = "tenant##global"
+  }
+  attribute {
+    name   = "tier"
+    values = ["gold"]
+  }`),
+				ExpectError: regexp.MustCompile("conflicts with"),
+			},
+			{
+				Config: config(`
+  attributes = {
+    scope = "tenant##global"
+  }`),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "attributes.scope", "tenant##global"),
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "attribute.#", "0"),
+					testAccCheckRealmRoleAttribute(server, "reader", "scope", []string{"tenant", "global"}),
+				),
+			},
+			{
+				// moving to attribute blocks keeps the values
+				Config: config(`
+  attribute {
+    name   = "scope"
+    values = ["tenant", "global"]
+  }`),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "attributes.%", "0"),
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "attribute.#", "1"),
+					testAccCheckRealmRoleAttribute(server, "reader", "scope", []string{"tenant", "global"}),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRealmRole_mergeAttributes(t *testing.T) {
+	server := testKeycloak(t)
+	config := func(attributes string) string {
+		return testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_realm_role" "role" {
+  realm_id        = %q
+  name            = "reader"
+  attributes_mode = "merge"
+%s
+}
+`, testRealm, attributes)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckRealmRoleDestroy(server, "reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: config(`
+  attribute {
+    name   = "scope"
+    values = ["tenant"]
+  }`),
+			},
+			{
+				// written by another system, not drift
+				PreConfig: func() {
+					role := server.RealmRole(testRealm, "reader")
+					server.UpdateRole(testRealm, *role.ID, "", map[string][]string{"scope": {"tenant"}, "onboarding": {"done"}})
+				},
+				Config: config(`
+  attribute {
+    name   = "scope"
+    values = ["tenant"]
+  }`),
+				PlanOnly: true,
+			},
+			{
+				Config: config(`
+  attribute {
+    name   = "scope"
+    values = ["tenant", "global"]
+  }`),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckRealmRoleAttribute(server, "reader", "scope", []string{"tenant", "global"}),
+					testAccCheckRealmRoleAttribute(server, "reader", "onboarding", []string{"done"}),
+				),
+			},
+			{
+				Config: config(`
+  attribute {
+    name   = "tier"
+    values = ["gold"]
+  }`),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "attribute.#", "1"),
+					testAccCheckRealmRoleAttribute(server, "reader", "scope", nil),
+					testAccCheckRealmRoleAttribute(server, "reader", "tier", []string{"gold"}),
+					testAccCheckRealmRoleAttribute(server, "reader", "onboarding", []string{"done"}),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRealmRole_drift(t *testing.T) {
+	server := testKeycloak(t)
+	config := testProviderConfig(server) + testRealmRoleConfig("reader", "can read", "tenant")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckRealmRoleDestroy(server, "reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+			},
+			{
+				// changed in the admin console
+				PreConfig: func() {
+					role := server.RealmRole(testRealm, "reader")
+					server.UpdateRole(testRealm, *role.ID, "changed", map[string][]string{})
+				},
+				Config: config,
+				Check:  testAccCheckRealmRoleDescription(server, "reader", "can read"),
+			},
+			{
+				// deleted in the admin console
+				PreConfig: func() {
+					role := server.RealmRole(testRealm, "reader")
+					server.DeleteRole(testRealm, *role.ID)
+				},
+				Config: config,
+				Check:  testAccCheckRealmRoleDescription(server, "reader", "can read"),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRealmRole_import(t *testing.T) {
+	server := testKeycloak(t)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckRealmRoleDestroy(server, "reader"),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testRealmRoleConfig("reader", "can read", "tenant", "global"),
+			},
+			{
+				ResourceName:      "embracecloud_realm_role.role",
+				ImportState:       true,
+				ImportStateId:     testRealm + "/reader",
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName: "embracecloud_realm_role.role",
+				ImportState:  true,
+				ImportStateIdFunc: func(s *terraform.State) (string, error) {
+					return testRealm + "/" + *server.RealmRole(testRealm, "reader").ID, nil
+				},
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName:  "embracecloud_realm_role.role",
+				ImportState:   true,
+				ImportStateId: testRealm + "/writer",
+				ExpectError:   regexp.MustCompile("no realm role with name or id writer found in realm test"),
+			},
+			{
+				ResourceName:  "embracecloud_realm_role.role",
+				ImportState:   true,
+				ImportStateId: "reader",
+				ExpectError:   regexp.MustCompile("invalid import id reader"),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRealmRoleImport_slashInName(t *testing.T) {
+	server := testKeycloak(t)
+
+	// everything after the realm is the role name or id
+	data := schema.TestResourceDataRaw(t, resourceKeycloakRealmRole().Schema, map[string]interface{}{})
+	data.SetId(testRealm + "/team/reader")
+	_, err := resourceKeycloakRealmRoleImport(context.Background(), data, testProviderClient(server))
+	if err == nil || err.Error() != "no realm role with name or id team/reader found in realm test" {
+		t.Errorf("expected the role team/reader to be looked up in realm test, got %v", err)
+	}
+}
+
+func TestResourceKeycloakRealmRole_rename(t *testing.T) {
+	server := testKeycloak(t)
+	admin := server.CreateRealmRole(testRealm, "admin")
+	alice := server.CreateUser(testRealm, "alice")
+	var id string
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckRealmRoleDestroy(server, "reader", "viewer"),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testRealmRoleConfig("reader", "can read", "tenant"),
+			},
+			{
+				// granted and nested in the admin console
+				PreConfig: func() {
+					id = *server.RealmRole(testRealm, "reader").ID
+					server.AddComposite(testRealm, admin, id)
+					server.GrantRole(testRealm, alice, id)
+				},
+				Config:             testProviderConfig(server) + testRealmRoleConfig("viewer", "can read", "tenant"),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				// only the apply looks up what refers to the role
+				PreConfig: func() {
+					if got := server.RequestCount(http.MethodGet, "/roles/reader/users$"); got != 0 {
+						t.Fatalf("expected the plan not to look up the holders of the role, got %d requests", got)
+					}
+				},
+				Config: testProviderConfig(server) + testRealmRoleConfig("viewer", "can read", "tenant"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "id", "viewer"),
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "name", "viewer"),
+					func(s *terraform.State) error {
+						if err := resource.TestCheckResourceAttr("embracecloud_realm_role.role", "keycloak_id", id)(s); err != nil {
+							return err
+						}
+						if server.RealmRole(testRealm, "reader") != nil {
+							return fmt.Errorf("realm role reader still exists")
+						}
+						if role := server.RealmRole(testRealm, "viewer"); role == nil || *role.ID != id {
+							return fmt.Errorf("expected realm role viewer to keep id %s, got %v", id, role)
+						}
+						if !server.HasRole(testRealm, alice, id) {
+							return fmt.Errorf("expected alice to keep the renamed role")
+						}
+						return nil
+					},
+					testAccCheckRealmRoleComposites(server, "admin", "viewer"),
+				),
+			},
+		},
+	})
+}
+
+func TestRoleRenameWarnings(t *testing.T) {
+	// the roles have their new names already, the warnings are made after the update
+	server := testKeycloak(t)
+	admin := server.CreateRealmRole(testRealm, "owner")
+	reader := server.CreateRealmRole(testRealm, "viewer")
+	tenantAdmin := server.CreateClientRole(testRealm, testClientId, "tenant-admin")
+	tenantReader := server.CreateClientRole(testRealm, testClientId, "tenant-viewer")
+	server.AddComposite(testRealm, admin, reader)
+	server.AddComposite(testRealm, tenantAdmin, tenantReader)
+	server.GrantRole(testRealm, server.CreateUser(testRealm, "alice"), reader)
+	server.GrantRole(testRealm, server.CreateGroup(testRealm, "ops"), tenantReader)
+
+	api := testKeycloakAPI(t, server)
+
+	diags := roleRenameWarnings(context.Background(), api, testRealm, "", "reader", "viewer")
+	if len(diags) != 1 || diags[0].Severity != diag.Warning {
+		t.Fatalf("expected one warning, got %v", diags)
+	}
+	if expected := "keycloak keeps the following, configuration that refers to the role as reader has to be updated: composite of realm role owner, granted to user alice"; diags[0].Detail != expected {
+		t.Errorf("expected detail %q, got %q", expected, diags[0].Detail)
+	}
+
+	idOfClient, err := api.GetClientUUID(context.Background(), testRealm, testClientId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diags = roleRenameWarnings(context.Background(), api, testRealm, idOfClient, "tenant-reader", "tenant-viewer")
+	if expected := "keycloak keeps the following, configuration that refers to the role as tenant-reader has to be updated: composite of client role tenant-admin, granted to group /ops"; len(diags) != 1 || diags[0].Detail != expected {
+		t.Errorf("expected detail %q, got %v", expected, diags)
+	}
+
+	if diags := roleRenameWarnings(context.Background(), api, testRealm, "", "admin", "owner"); len(diags) != 0 {
+		t.Errorf("expected no warning for a role nothing refers to, got %v", diags)
+	}
+}
+
+func TestResourceKeycloakRealmRole_compositeRoles(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateRealmRole(testRealm, "reader")
+	server.CreateRealmRole(testRealm, "writer")
+	legacy := server.CreateRealmRole(testRealm, "legacy")
+	server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	config := func(compositeRoles string) string {
+		return testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_realm_role" "role" {
+  realm_id = %q
+  name     = "admin"
+%s
+}
+`, testRealm, compositeRoles)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckRealmRoleDestroy(server, "admin"),
+		Steps: []resource.TestStep{
+			{
+				Config: config(fmt.Sprintf(`
+  composite_roles {
+    realm_roles = ["reader"]
+    client_roles {
+      client_id = %q
+      role_name = "tenant-reader"
+    }
+  }`, testClientId)),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "composite_roles.0.realm_roles.#", "1"),
+					resource.TestCheckResourceAttr("embracecloud_realm_role.role", "composite_roles.0.client_roles.#", "1"),
+					testAccCheckRealmRoleComposites(server, "admin", "reader", "tenant-reader"),
+				),
+			},
+			{
+				Config: config(`
+  composite_roles {
+    realm_roles = ["reader", "writer"]
+  }`),
+				Check: testAccCheckRealmRoleComposites(server, "admin", "reader", "writer"),
+			},
+			{
+				// composite added in the admin console, the block does not list it
+				PreConfig: func() {
+					server.AddComposite(testRealm, testRealmRoleId(server, "admin"), legacy)
+				},
+				Config: config(`
+  composite_roles {
+    realm_roles = ["reader", "writer"]
+  }`),
+				Check: testAccCheckRealmRoleComposites(server, "admin", "reader", "writer", "legacy"),
+			},
+			{
+				// without the block its composites are removed, legacy is kept
+				Config: config(""),
+				Check:  testAccCheckRealmRoleComposites(server, "admin", "legacy"),
+			},
+		},
+	})
+}
+
+// the composite_roles block leaves the composites of a composite resource alone
+func TestResourceKeycloakRealmRole_compositeRolesWithCompositeResource(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateRealmRole(testRealm, "reader")
+	server.CreateRealmRole(testRealm, "writer")
+	config := testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_realm_role" "role" {
+  realm_id = %[1]q
+  name     = "admin"
+
+  composite_roles {
+    realm_roles = ["reader"]
+  }
+}
+
+resource "embracecloud_realm_role_composite" "writer" {
+  realm_id            = %[1]q
+  parent_role_name    = embracecloud_realm_role.role.name
+  composite_role_name = "writer"
+}
+`, testRealm)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckRealmRoleDestroy(server, "admin"),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check:  testAccCheckRealmRoleComposites(server, "admin", "reader", "writer"),
+			},
+			{
+				Config:   config,
+				PlanOnly: true,
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRealmRole_serverError(t *testing.T) {
+	server := testKeycloak(t)
+	server.InjectFault(keycloaktest.Fault{
+		Method: http.MethodPost,
+		Path:   "/roles$",
+		Status: http.StatusInternalServerError,
+	})
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckRealmRoleDestroy(server, "reader"),
+		Steps: []resource.TestStep{
+			{
+				Config:      testProviderConfig(server) + testRealmRoleConfig("reader", "can read", "tenant"),
+				ExpectError: regexp.MustCompile("could not create realm role reader in realm test"),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRoleStateUpgradeV0(t *testing.T) {
+	state, err := resourceKeycloakRoleStateUpgradeV0(context.Background(), map[string]interface{}{
+		"id":       "reader",
+		"realm_id": "test",
+		"name":     "reader",
+		"attributes": map[string]interface{}{
+			"scope": "tenant##global",
+			"tier":  "gold",
+		},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the deprecated attributes argument still reads the map
+	expected := map[string]interface{}{
+		"scope": "tenant##global",
+		"tier":  "gold",
+	}
+	if !reflect.DeepEqual(state["attributes"], expected) {
+		t.Errorf("expected attributes %v, got %v", expected, state["attributes"])
+	}
+}
+
+func testRealmRoleConfig(name string, description string, scopes ...string) string {
+	return fmt.Sprintf(`
+resource "embracecloud_realm_role" "role" {
+  realm_id    = %q
+  name        = %q
+  description = %q
+  attribute {
+    name   = "scope"
+    values = %s
+  }
+}
+`, testRealm, name, description, testHclList(scopes))
+}
+
+func testAccCheckRealmRoleDescription(server *keycloaktest.Server, name string, description string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		role := server.RealmRole(testRealm, name)
+		if role == nil {
+			return fmt.Errorf("realm role %s does not exist", name)
+		}
+		if *role.Description != description {
+			return fmt.Errorf("expected description %q of realm role %s, got %q", description, name, *role.Description)
+		}
+		return nil
+	}
+}
+
+func testAccCheckRealmRoleAttribute(server *keycloaktest.Server, name string, key string, values []string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		role := server.RealmRole(testRealm, name)
+		if role == nil {
+			return fmt.Errorf("realm role %s does not exist", name)
+		}
+		if got := (*role.Attributes)[key]; fmt.Sprint(got) != fmt.Sprint(values) {
+			return fmt.Errorf("expected attribute %s of realm role %s to be %v, got %v", key, name, values, got)
+		}
+		return nil
+	}
+}
+
+func testAccCheckRealmRoleDestroy(server *keycloaktest.Server, names ...string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		for _, name := range names {
+			if server.RealmRole(testRealm, name) != nil {
+				return fmt.Errorf("realm role %s still exists", name)
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,500 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v12"
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// resourceKeycloakRoleComposites owns all composites of one parent role.
+// Composites that are not configured are removed, so it must not be combined
+// with embracecloud_realm_role_composite or embracecloud_client_role_composite
+// for the same parent.
+func resourceKeycloakRoleComposites() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceKeycloakRoleCompositesCreate,
+		ReadContext:   resourceKeycloakRoleCompositesRead,
+		UpdateContext: resourceKeycloakRoleCompositesUpdate,
+		DeleteContext: resourceKeycloakRoleCompositesDelete,
+		// This resource can be imported using {{realm}}/{{clientId}}/{{parentRoleName}}, with {{clientId}} left empty when the parent is a realm role
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceKeycloakRoleCompositesImport,
+		},
+		Schema: map[string]*schema.Schema{
+			"realm_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"client_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "client of the parent role, leave empty when the parent is a realm role",
+			},
+			"parent_role_name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"realm_roles": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Elem:        &schema.Schema{Type: schema.TypeString},
+				Description: "names of the realm roles that are composites of the parent role",
+			},
+			"client_roles": {
+				Type:        schema.TypeSet,
+				Optional:    true,
+				Elem:        compositeClientRoleResource(),
+				Description: "client roles that are composites of the parent role",
+			},
+		},
+	}
+}
+
+func compositeClientRoleResource() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"client_id": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"role_name": {
+				Type:     schema.TypeString,
+				Required: true,
+			},
+		},
+	}
+}
+
+// compositeRolesSchema is the composite_roles block of embracecloud_realm_role
+// and embracecloud_client_role. It only manages the composites it lists, so
+// composite resources can add others to the same role.
+func compositeRolesSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:        schema.TypeList,
+		Optional:    true,
+		MaxItems:    1,
+		Description: "composites of the role, composites that are not listed are left alone",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"realm_roles": {
+					Type:        schema.TypeSet,
+					Optional:    true,
+					Elem:        &schema.Schema{Type: schema.TypeString},
+					Description: "names of the realm roles that are composites of the role",
+				},
+				"client_roles": {
+					Type:        schema.TypeSet,
+					Optional:    true,
+					Elem:        compositeClientRoleResource(),
+					Description: "client roles that are composites of the role",
+				},
+			},
+		},
+	}
+}
+
+// compositeRolesBlock returns the realm roles and the client roles of a
+// composite_roles value, both are empty without the block
+func compositeRolesBlock(value interface{}) (*schema.Set, *schema.Set) {
+	realmRoles := schema.NewSet(schema.HashString, nil)
+	clientRoles := schema.NewSet(schema.HashResource(compositeClientRoleResource()), nil)
+
+	// an empty block is read as nil
+	if blocks, ok := value.([]interface{}); ok && len(blocks) > 0 {
+		if block, ok := blocks[0].(map[string]interface{}); ok {
+			realmRoles = block["realm_roles"].(*schema.Set)
+			clientRoles = block["client_roles"].(*schema.Set)
+		}
+	}
+
+	return realmRoles, clientRoles
+}
+
+// applyInlineCompositeRoles adds the composites the composite_roles block
+// lists to the role with id roleId and removes the ones that were taken out
+// of the block. Composites the block never listed are left alone.
+func applyInlineCompositeRoles(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, data *schema.ResourceData, realm string, roleId string) error {
+	oldValue, newValue := data.GetChange("composite_roles")
+	oldRealmRoles, oldClientRoles := compositeRolesBlock(oldValue)
+	realmRoles, clientRoles := compositeRolesBlock(newValue)
+
+	add, err := expandCompositeRoles(ctx, keycloakCLient, realm, realmRoles, clientRoles, false)
+	if err != nil {
+		return err
+	}
+	// a role that was taken out of the block and deleted is no composite anymore
+	remove, err := expandCompositeRoles(ctx, keycloakCLient, realm, oldRealmRoles.Difference(realmRoles), oldClientRoles.Difference(clientRoles), true)
+	if err != nil {
+		return err
+	}
+
+	current, err := keycloakCLient.GetCompositeRolesByRoleID(ctx, realm, roleId)
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for _, role := range current {
+		existing[*role.ID] = true
+	}
+
+	var missing, extra []gocloak.Role
+	for _, role := range add {
+		if !existing[*role.ID] {
+			missing = append(missing, role)
+		}
+	}
+	for _, role := range remove {
+		if existing[*role.ID] {
+			extra = append(extra, role)
+		}
+	}
+
+	return changeCompositeRoles(ctx, keycloakCLient, realm, roleId, missing, extra)
+}
+
+// readInlineCompositeRoles refreshes the composites the composite_roles block
+// lists, the ones it does not list are left out
+func readInlineCompositeRoles(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, data *schema.ResourceData, realm string, roleId string) error {
+	if len(data.Get("composite_roles").([]interface{})) == 0 {
+		return nil
+	}
+	listedRealmRoles, listedClientRoles := compositeRolesBlock(data.Get("composite_roles"))
+
+	composites, err := keycloakCLient.GetCompositeRolesByRoleID(ctx, realm, roleId)
+	if err != nil {
+		return err
+	}
+
+	realmRoles, clientRoles, err := flattenCompositeRoles(ctx, keycloakCLient, realm, composites)
+	if err != nil {
+		return err
+	}
+
+	listed := map[string]interface{}{
+		"realm_roles":  []interface{}{},
+		"client_roles": []interface{}{},
+	}
+	for _, name := range realmRoles {
+		if listedRealmRoles.Contains(name) {
+			listed["realm_roles"] = append(listed["realm_roles"].([]interface{}), name)
+		}
+	}
+	for _, clientRole := range clientRoles {
+		if listedClientRoles.Contains(clientRole) {
+			listed["client_roles"] = append(listed["client_roles"].([]interface{}), clientRole)
+		}
+	}
+
+	return data.Set("composite_roles", []interface{}{listed})
+}
+
+func resourceKeycloakRoleCompositesCreate(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	realm := data.Get("realm_id").(string)
+	clientId := data.Get("client_id").(string)
+	roleName := data.Get("parent_role_name").(string)
+
+	if diags := resourceKeycloakRoleCompositesApply(ctx, data, meta); diags.HasError() {
+		return diags
+	}
+
+	data.SetId(roleCompositesId(realm, clientId, roleName))
+
+	return resourceKeycloakRoleCompositesRead(ctx, data, meta)
+}
+
+func resourceKeycloakRoleCompositesRead(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	realm := data.Get("realm_id").(string)
+	clientId := data.Get("client_id").(string)
+	roleName := data.Get("parent_role_name").(string)
+
+	role, err := getRole(ctx, keycloakCLient, realm, clientId, roleName)
+	if err != nil {
+		if embracecloud.IsNotFound(err) {
+			data.SetId("")
+			return nil
+		}
+		return diag.FromErr(err)
+	}
+
+	composites, err := keycloakCLient.GetCompositeRolesByRoleID(ctx, realm, *role.ID)
+	if err != nil {
+		return diag.Errorf("could not get composites of role %s in realm %s error -> %s", roleName, realm, err.Error())
+	}
+
+	realmRoles, clientRoles, err := flattenCompositeRoles(ctx, keycloakCLient, realm, composites)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	data.Set("realm_roles", realmRoles)
+	data.Set("client_roles", clientRoles)
+
+	return nil
+}
+
+func resourceKeycloakRoleCompositesUpdate(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	if diags := resourceKeycloakRoleCompositesApply(ctx, data, meta); diags.HasError() {
+		return diags
+	}
+
+	return resourceKeycloakRoleCompositesRead(ctx, data, meta)
+}
+
+func resourceKeycloakRoleCompositesDelete(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	realm := data.Get("realm_id").(string)
+	clientId := data.Get("client_id").(string)
+	roleName := data.Get("parent_role_name").(string)
+
+	role, err := getRole(ctx, keycloakCLient, realm, clientId, roleName)
+	if err != nil {
+		if embracecloud.IsNotFound(err) {
+			// the parent role is already removed outside terraform, so are its composites
+			return nil
+		}
+		return diag.FromErr(err)
+	}
+
+	if err := setCompositeRoles(ctx, keycloakCLient, realm, *role.ID, nil); err != nil {
+		return diag.Errorf("could not remove composites of role %s in realm %s error -> %s", roleName, realm, err.Error())
+	}
+
+	return nil
+}
+
+func resourceKeycloakRoleCompositesImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	parts := strings.Split(d.Id(), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[2] == "" {
+		return nil, fmt.Errorf("invalid import id %s, expected {{realm}}/{{clientId}}/{{parentRoleName}} with the client id left empty for a realm role", d.Id())
+	}
+
+	d.Set("realm_id", parts[0])
+	if parts[1] != "" {
+		d.Set("client_id", parts[1])
+	}
+	d.Set("parent_role_name", parts[2])
+
+	return []*schema.ResourceData{d}, nil
+}
+
+// resourceKeycloakRoleCompositesApply makes the composites of the parent role
+// match the configuration
+func resourceKeycloakRoleCompositesApply(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	realm := data.Get("realm_id").(string)
+	clientId := data.Get("client_id").(string)
+	roleName := data.Get("parent_role_name").(string)
+
+	role, err := getRole(ctx, keycloakCLient, realm, clientId, roleName)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	composites, err := expandCompositeRoles(ctx, keycloakCLient, realm, data.Get("realm_roles").(*schema.Set), data.Get("client_roles").(*schema.Set), false)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	if err := setCompositeRoles(ctx, keycloakCLient, realm, *role.ID, composites); err != nil {
+		return diag.Errorf("could not update composites of role %s in realm %s error -> %s", roleName, realm, err.Error())
+	}
+
+	return nil
+}
+
+// roleCompositesId builds {{realm}}/{{clientId}}/{{roleName}}, the client id
+// is left empty for a realm role
+func roleCompositesId(realm string, clientId string, roleName string) string {
+	return strings.Join([]string{realm, clientId, roleName}, "/")
+}
+
+// getRole looks up the role of the client with client id clientId, or the
+// realm role when clientId is empty. A missing role or client is reported
+// with an error embracecloud.IsNotFound recognizes.
+func getRole(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, clientId string, roleName string) (*gocloak.Role, error) {
+	if clientId == "" {
+		role, err := keycloakCLient.GetRealmRole(ctx, realm, roleName)
+		if err != nil {
+			return nil, fmt.Errorf("could not find realm role %s in realm %s error -> %w", roleName, realm, err)
+		}
+		return role, nil
+	}
+
+	idOfClient, err := keycloakCLient.GetClientUUID(ctx, realm, clientId)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := keycloakCLient.GetClientRole(ctx, realm, idOfClient, roleName)
+	if err != nil {
+		return nil, fmt.Errorf("could not find client role in client %s with name %s in realm %s error -> %w", clientId, roleName, realm, err)
+	}
+	return role, nil
+}
+
+// expandCompositeRoles looks up the configured realm role names and client
+// role blocks, skipMissing leaves out roles that do not exist
+func expandCompositeRoles(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, realmRoles *schema.Set, clientRoles *schema.Set, skipMissing bool) ([]gocloak.Role, error) {
+	var roles []gocloak.Role
+
+	for _, name := range realmRoles.List() {
+		role, err := getRole(ctx, keycloakCLient, realm, "", name.(string))
+		if err != nil {
+			if skipMissing && embracecloud.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		roles = append(roles, *role)
+	}
+
+	for _, v := range clientRoles.List() {
+		clientRole := v.(map[string]interface{})
+		role, err := getRole(ctx, keycloakCLient, realm, clientRole["client_id"].(string), clientRole["role_name"].(string))
+		if err != nil {
+			if skipMissing && embracecloud.IsNotFound(err) {
+				continue
+			}
+			return nil, err
+		}
+		roles = append(roles, *role)
+	}
+
+	return roles, nil
+}
+
+// flattenCompositeRoles splits composites as returned by keycloak into realm
+// role names and client role blocks
+func flattenCompositeRoles(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, composites []*gocloak.Role) ([]string, []interface{}, error) {
+	realmRoles := []string{}
+	clientRoles := []interface{}{}
+	clientIds := map[string]string{}
+
+	for _, composite := range composites {
+		if !gocloak.PBool(composite.ClientRole) {
+			realmRoles = append(realmRoles, *composite.Name)
+			continue
+		}
+
+		idOfClient := gocloak.PString(composite.ContainerID)
+		clientId, ok := clientIds[idOfClient]
+		if !ok {
+			client, err := keycloakCLient.GetClient(ctx, realm, idOfClient)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cannot find client %s of composite role %s in realm %s error -> %s", idOfClient, *composite.Name, realm, err.Error())
+			}
+			clientId = *client.ClientID
+			clientIds[idOfClient] = clientId
+		}
+
+		clientRoles = append(clientRoles, map[string]interface{}{
+			"client_id": clientId,
+			"role_name": *composite.Name,
+		})
+	}
+
+	sort.Strings(realmRoles)
+	return realmRoles, clientRoles, nil
+}
+
+// setCompositeRoles adds the missing and removes the extra composites of the
+// role with id roleId, with at most one request for each
+func setCompositeRoles(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, roleId string, roles []gocloak.Role) error {
+	current, err := keycloakCLient.GetCompositeRolesByRoleID(ctx, realm, roleId)
+	if err != nil {
+		return err
+	}
+
+	wanted := map[string]bool{}
+	for _, role := range roles {
+		wanted[*role.ID] = true
+	}
+	existing := map[string]bool{}
+	for _, role := range current {
+		existing[*role.ID] = true
+	}
+
+	var add, remove []gocloak.Role
+	for _, role := range roles {
+		if !existing[*role.ID] {
+			add = append(add, role)
+		}
+	}
+	for _, role := range current {
+		if !wanted[*role.ID] {
+			remove = append(remove, *role)
+		}
+	}
+
+	return changeCompositeRoles(ctx, keycloakCLient, realm, roleId, add, remove)
+}
+
+// changeCompositeRoles adds and removes composites of the role with id roleId
+func changeCompositeRoles(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, roleId string, add []gocloak.Role, remove []gocloak.Role) error {
+	// the composites endpoints by role id work for realm and client roles alike
+	if len(remove) > 0 {
+		if err := keycloakCLient.DeleteClientRoleComposite(ctx, realm, roleId, remove); err != nil {
+			return err
+		}
+	}
+	if len(add) > 0 {
+		if err := keycloakCLient.AddClientRoleComposite(ctx, realm, roleId, add); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// compositeParents returns the realm roles and the roles of the clients with
+// the given ids that have the role with id roleId as direct composite
+func compositeParents(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, roleId string, idsOfClients []string) ([]*gocloak.Role, error) {
+	candidates, err := keycloakCLient.GetRealmRoles(ctx, realm, gocloak.GetRoleParams{})
+	if err != nil {
+		return nil, err
+	}
+	for _, idOfClient := range idsOfClients {
+		clientRoles, err := keycloakCLient.GetClientRoles(ctx, realm, idOfClient, gocloak.GetRoleParams{})
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, clientRoles...)
+	}
+
+	var parents []*gocloak.Role
+	for _, candidate := range candidates {
+		if !gocloak.PBool(candidate.Composite) {
+			continue
+		}
+		composite, err := hasComposite(ctx, keycloakCLient, realm, *candidate.ID, roleId)
+		if err != nil {
+			return nil, err
+		}
+		if composite {
+			parents = append(parents, candidate)
+		}
+	}
+	return parents, nil
+}
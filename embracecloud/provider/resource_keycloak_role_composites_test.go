@@ -0,0 +1,227 @@
+package provider
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"testing"
+
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceKeycloakRoleComposites_basic(t *testing.T) {
+	server := testKeycloak(t)
+	admin := server.CreateRealmRole(testRealm, "admin")
+	legacy := server.CreateRealmRole(testRealm, "legacy")
+	server.CreateRealmRole(testRealm, "reader")
+	server.CreateRealmRole(testRealm, "writer")
+	server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	tenantAdmin := server.CreateClientRole(testRealm, testClientId, "tenant-admin")
+	server.AddComposite(testRealm, admin, legacy)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy: resource.ComposeTestCheckFunc(
+			testAccCheckCompositesDestroy(server, admin),
+			testAccCheckCompositesDestroy(server, tenantAdmin),
+		),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testRoleCompositesConfig(`["reader"]`, "tenant-reader"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_role_composites.realm", "id", "test//admin"),
+					resource.TestCheckResourceAttr("embracecloud_role_composites.client", "id", "test/test-client/tenant-admin"),
+					testAccCheckComposites(server, admin, "reader", "tenant-reader"),
+					testAccCheckComposites(server, tenantAdmin, "reader", "tenant-reader"),
+				),
+			},
+			{
+				Config: testProviderConfig(server) + testRoleCompositesConfig(`["reader", "writer"]`, ""),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComposites(server, admin, "reader", "writer"),
+					testAccCheckComposites(server, tenantAdmin, "reader", "writer"),
+				),
+			},
+			{
+				ResourceName:      "embracecloud_role_composites.realm",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+			{
+				ResourceName:      "embracecloud_role_composites.client",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRoleComposites_clientCalledRealm(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateClient(testRealm, "realm")
+	tenantAdmin := server.CreateClientRole(testRealm, "realm", "tenant-admin")
+	server.CreateRealmRole(testRealm, "reader")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckCompositesDestroy(server, tenantAdmin),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_role_composites" "client" {
+  realm_id         = %q
+  client_id        = "realm"
+  parent_role_name = "tenant-admin"
+  realm_roles      = ["reader"]
+}
+`, testRealm),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_role_composites.client", "id", "test/realm/tenant-admin"),
+					testAccCheckComposites(server, tenantAdmin, "reader"),
+				),
+			},
+			{
+				ResourceName:      "embracecloud_role_composites.client",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRoleComposites_batched(t *testing.T) {
+	server := testKeycloak(t)
+	admin := server.CreateRealmRole(testRealm, "admin")
+	for _, name := range []string{"legacy", "old"} {
+		server.AddComposite(testRealm, admin, server.CreateRealmRole(testRealm, name))
+	}
+	for _, name := range []string{"reader", "writer", "auditor"} {
+		server.CreateRealmRole(testRealm, name)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckCompositesDestroy(server, admin),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_role_composites" "realm" {
+  realm_id         = %q
+  parent_role_name = "admin"
+  realm_roles      = ["reader", "writer", "auditor"]
+}
+`, testRealm),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckComposites(server, admin, "reader", "writer", "auditor"),
+					testAccCheckRequestCount(server, http.MethodPost, "/roles-by-id/.*/composites$", 1),
+					testAccCheckRequestCount(server, http.MethodDelete, "/roles-by-id/.*/composites$", 1),
+				),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRoleComposites_drift(t *testing.T) {
+	server := testKeycloak(t)
+	admin := server.CreateRealmRole(testRealm, "admin")
+	server.CreateRealmRole(testRealm, "reader")
+	legacy := server.CreateRealmRole(testRealm, "legacy")
+	config := testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_role_composites" "realm" {
+  realm_id         = %q
+  parent_role_name = "admin"
+  realm_roles      = ["reader"]
+}
+`, testRealm)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckCompositesDestroy(server, admin),
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check:  testAccCheckComposites(server, admin, "reader"),
+			},
+			{
+				// composite added in the admin console
+				PreConfig: func() {
+					server.AddComposite(testRealm, admin, legacy)
+				},
+				Config:             config,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+			{
+				Config: config,
+				Check:  testAccCheckComposites(server, admin, "reader"),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRoleComposites_missingRole(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateRealmRole(testRealm, "admin")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_role_composites" "realm" {
+  realm_id         = %q
+  parent_role_name = "admin"
+  realm_roles      = ["reader"]
+}
+`, testRealm),
+				ExpectError: regexp.MustCompile("could not find realm role reader in realm test"),
+			},
+		},
+	})
+}
+
+// testRoleCompositesConfig gives the realm role admin and the client role
+// tenant-admin the same composites
+func testRoleCompositesConfig(realmRoles string, clientRole string) string {
+	clientRoles := ""
+	if clientRole != "" {
+		clientRoles = fmt.Sprintf(`
+  client_roles {
+    client_id = %q
+    role_name = %q
+  }`, testClientId, clientRole)
+	}
+
+	return fmt.Sprintf(`
+resource "embracecloud_role_composites" "realm" {
+  realm_id         = %[1]q
+  parent_role_name = "admin"
+  realm_roles      = %[3]s
+%[4]s
+}
+
+resource "embracecloud_role_composites" "client" {
+  realm_id         = %[1]q
+  client_id        = %[2]q
+  parent_role_name = "tenant-admin"
+  realm_roles      = %[3]s
+%[4]s
+}
+`, testRealm, testClientId, realmRoles, clientRoles)
+}
+
+func testAccCheckRequestCount(server *keycloaktest.Server, method string, path string, count int) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		if got := server.RequestCount(method, path); got != count {
+			return fmt.Errorf("expected %d %s requests to %s, got %d", count, method, path, got)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,307 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Nerzal/gocloak/v12"
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// resourceKeycloakRoleMigration moves a role between the realm and a client,
+// or between two clients, without taking it away from anyone who holds it.
+// The work is done when it is created, deleting it only drops it from the
+// state. The id is laid out like the composite ids,
+// {{realm}}/{{sourceClientId}}/{{sourceRoleName}}/{{targetClientId}}/{{targetRoleName}}.
+func resourceKeycloakRoleMigration() *schema.Resource {
+	return &schema.Resource{
+		CreateContext: resourceKeycloakRoleMigrationCreate,
+		ReadContext:   resourceKeycloakRoleMigrationRead,
+		DeleteContext: resourceKeycloakRoleMigrationDelete,
+		// A migration that is already done can be imported using its id
+		Importer: &schema.ResourceImporter{
+			StateContext: resourceKeycloakRoleMigrationImport,
+		},
+		Schema: map[string]*schema.Schema{
+			"realm_id": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"source_client_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "client of the role that is moved, leave empty when it is a realm role",
+			},
+			"source_role_name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"target_client_id": {
+				Type:        schema.TypeString,
+				Optional:    true,
+				ForceNew:    true,
+				Description: "client the role is moved to, leave empty to move it to the realm",
+			},
+			"target_role_name": {
+				Type:     schema.TypeString,
+				Required: true,
+				ForceNew: true,
+			},
+			"target_keycloak_id": {
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func resourceKeycloakRoleMigrationCreate(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	realm := data.Get("realm_id").(string)
+	sourceClientId := data.Get("source_client_id").(string)
+	sourceRoleName := data.Get("source_role_name").(string)
+	targetClientId := data.Get("target_client_id").(string)
+	targetRoleName := data.Get("target_role_name").(string)
+
+	if sourceClientId == targetClientId && sourceRoleName == targetRoleName {
+		return diag.Errorf("source and target of the migration are the same role %s", sourceRoleName)
+	}
+
+	idOfSourceClient, err := idOfRoleClient(ctx, keycloakCLient, realm, sourceClientId)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	idOfTargetClient, err := idOfRoleClient(ctx, keycloakCLient, realm, targetClientId)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+
+	// an existing target is reused, so a migration that failed halfway
+	// continues where it stopped
+	target, err := getRole(ctx, keycloakCLient, realm, targetClientId, targetRoleName)
+	if err != nil && !embracecloud.IsNotFound(err) {
+		return diag.FromErr(err)
+	}
+
+	source, err := getRole(ctx, keycloakCLient, realm, sourceClientId, sourceRoleName)
+	if err != nil {
+		// a done migration looks the same as a misspelled source, only an
+		// import tells them apart
+		if embracecloud.IsNotFound(err) && target != nil {
+			return diag.Errorf("source role %s of the migration to %s not found in realm %s, if the migration is already done import it with the id %s", sourceRoleName, targetRoleName, realm, compositeId(realm, sourceClientId, sourceRoleName, targetClientId, targetRoleName))
+		}
+		return diag.FromErr(err)
+	}
+
+	if target == nil {
+		copied := gocloak.Role{
+			Name:        gocloak.StringP(targetRoleName),
+			Description: source.Description,
+			Attributes:  source.Attributes,
+		}
+		if idOfTargetClient == "" {
+			_, err = keycloakCLient.CreateRealmRole(ctx, realm, copied)
+		} else {
+			_, err = keycloakCLient.CreateClientRole(ctx, realm, idOfTargetClient, copied)
+		}
+		if err != nil {
+			return diag.Errorf("could not create role %s to migrate %s to in realm %s error -> %s", targetRoleName, sourceRoleName, realm, err.Error())
+		}
+
+		target, err = getRole(ctx, keycloakCLient, realm, targetClientId, targetRoleName)
+		if err != nil {
+			return diag.FromErr(err)
+		}
+	} else if filled, changed := fillMissingRoleFields(*target, *source); changed {
+		// the description and attributes the target already has are kept
+		if err := keycloakCLient.UpdateRoleByID(ctx, realm, *target.ID, filled); err != nil {
+			return diag.Errorf("could not update role %s to migrate %s to in realm %s error -> %s", targetRoleName, sourceRoleName, realm, err.Error())
+		}
+	}
+
+	if err := copyRoleGrants(ctx, keycloakCLient, realm, source, idOfSourceClient, target, idOfTargetClient); err != nil {
+		return diag.Errorf("could not migrate role %s to %s in realm %s error -> %s", sourceRoleName, targetRoleName, realm, err.Error())
+	}
+
+	if idOfSourceClient == "" {
+		err = keycloakCLient.DeleteRealmRole(ctx, realm, sourceRoleName)
+	} else {
+		err = keycloakCLient.DeleteClientRole(ctx, realm, idOfSourceClient, sourceRoleName)
+	}
+	if err != nil {
+		return diag.Errorf("could not delete role %s after migrating it to %s in realm %s error -> %s", sourceRoleName, targetRoleName, realm, err.Error())
+	}
+
+	data.SetId(compositeId(realm, sourceClientId, sourceRoleName, targetClientId, targetRoleName))
+
+	return resourceKeycloakRoleMigrationRead(ctx, data, meta)
+}
+
+// fillMissingRoleFields gives target the description and the attributes of
+// source it does not have yet
+func fillMissingRoleFields(target gocloak.Role, source gocloak.Role) (gocloak.Role, bool) {
+	changed := false
+
+	if gocloak.PString(target.Description) == "" && gocloak.PString(source.Description) != "" {
+		target.Description = source.Description
+		changed = true
+	}
+
+	if source.Attributes != nil {
+		attributes := map[string][]string{}
+		if target.Attributes != nil {
+			for key, values := range *target.Attributes {
+				attributes[key] = values
+			}
+		}
+		for key, values := range *source.Attributes {
+			if _, ok := attributes[key]; !ok {
+				attributes[key] = values
+				changed = true
+			}
+		}
+		target.Attributes = &attributes
+	}
+
+	return target, changed
+}
+
+func resourceKeycloakRoleMigrationRead(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
+	realm := data.Get("realm_id").(string)
+
+	target, err := getRole(ctx, keycloakCLient, realm, data.Get("target_client_id").(string), data.Get("target_role_name").(string))
+	if err != nil {
+		if embracecloud.IsNotFound(err) {
+			data.SetId("")
+			return nil
+		}
+		return diag.FromErr(err)
+	}
+
+	data.Set("target_keycloak_id", target.ID)
+	return nil
+}
+
+func resourceKeycloakRoleMigrationImport(ctx context.Context, d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	realm, sourceClientId, sourceRoleName, targetClientId, targetRoleName, err := parseCompositeId(d.Id())
+	if err != nil {
+		return nil, err
+	}
+
+	client := meta.(*embracecloud.EmbraceCloudClient)
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = getRole(ctx, keycloakCLient, realm, sourceClientId, sourceRoleName)
+	if err == nil {
+		return nil, fmt.Errorf("source role %s of the migration to %s still exists in realm %s, apply the migration instead of importing it", sourceRoleName, targetRoleName, realm)
+	}
+	if !embracecloud.IsNotFound(err) {
+		return nil, err
+	}
+
+	d.Set("realm_id", realm)
+	d.Set("source_client_id", sourceClientId)
+	d.Set("source_role_name", sourceRoleName)
+	d.Set("target_client_id", targetClientId)
+	d.Set("target_role_name", targetRoleName)
+
+	return []*schema.ResourceData{d}, nil
+}
+
+// the migration cannot be undone, the moved role is left as it is
+func resourceKeycloakRoleMigrationDelete(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
+	return nil
+}
+
+// idOfRoleClient returns the id of the client with client id clientId, or an
+// empty string for realm roles
+func idOfRoleClient(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, clientId string) (string, error) {
+	if clientId == "" {
+		return "", nil
+	}
+	return keycloakCLient.GetClientUUID(ctx, realm, clientId)
+}
+
+// copyRoleGrants gives target the composites of source, adds it to every role
+// source is a composite of and grants it to every user, service account and
+// group source is granted to
+func copyRoleGrants(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, source *gocloak.Role, idOfSourceClient string, target *gocloak.Role, idOfTargetClient string) error {
+	composites, err := keycloakCLient.GetCompositeRolesByRoleID(ctx, realm, *source.ID)
+	if err != nil {
+		return fmt.Errorf("could not get composites of role %s error -> %s", *source.Name, err.Error())
+	}
+	var copied []gocloak.Role
+	for _, composite := range composites {
+		if *composite.ID != *target.ID {
+			copied = append(copied, *composite)
+		}
+	}
+	if len(copied) > 0 {
+		if err := keycloakCLient.AddClientRoleComposite(ctx, realm, *target.ID, copied); err != nil {
+			return fmt.Errorf("could not copy composites of role %s error -> %s", *source.Name, err.Error())
+		}
+	}
+
+	// parents can be roles of any client
+	idsOfClients, err := keycloakCLient.GetClientUUIDs(ctx, realm)
+	if err != nil {
+		return err
+	}
+	parents, err := compositeParents(ctx, keycloakCLient, realm, *source.ID, idsOfClients)
+	if err != nil {
+		return fmt.Errorf("could not find the roles role %s is a composite of error -> %s", *source.Name, err.Error())
+	}
+	for _, parent := range parents {
+		if *parent.ID == *target.ID {
+			continue
+		}
+		if err := keycloakCLient.AddClientRoleComposite(ctx, realm, *parent.ID, []gocloak.Role{*target}); err != nil {
+			return fmt.Errorf("could not add role %s to the composites of %s error -> %s", *target.Name, *parent.Name, err.Error())
+		}
+	}
+
+	users, groups, err := roleHolders(ctx, keycloakCLient, realm, idOfSourceClient, *source.Name)
+	if err != nil {
+		return fmt.Errorf("could not find the users and groups role %s is granted to error -> %s", *source.Name, err.Error())
+	}
+	grant := []gocloak.Role{*target}
+	for _, user := range users {
+		if idOfTargetClient == "" {
+			err = keycloakCLient.AddRealmRoleToUser(ctx, realm, *user.ID, grant)
+		} else {
+			err = keycloakCLient.AddClientRoleToUser(ctx, realm, idOfTargetClient, *user.ID, grant)
+		}
+		if err != nil {
+			return fmt.Errorf("could not grant role %s to user %s error -> %s", *target.Name, gocloak.PString(user.Username), err.Error())
+		}
+	}
+	for _, group := range groups {
+		if idOfTargetClient == "" {
+			err = keycloakCLient.AddRealmRoleToGroup(ctx, realm, *group.ID, grant)
+		} else {
+			err = keycloakCLient.AddClientRoleToGroup(ctx, realm, idOfTargetClient, *group.ID, grant)
+		}
+		if err != nil {
+			return fmt.Errorf("could not grant role %s to group %s error -> %s", *target.Name, gocloak.PString(group.Path), err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package provider
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/Nerzal/gocloak/v12"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceKeycloakRoleMigration_clientToRealm(t *testing.T) {
+	server := testKeycloak(t)
+	source := server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	server.UpdateRole(testRealm, source, "reads tenants", map[string][]string{"scope": {"tenant", "global"}})
+	base := server.CreateRealmRole(testRealm, "base")
+	server.AddComposite(testRealm, source, base)
+	admin := server.CreateRealmRole(testRealm, "admin")
+	server.AddComposite(testRealm, admin, source)
+	server.CreateClient(testRealm, "other-client")
+	otherAdmin := server.CreateClientRole(testRealm, "other-client", "tenant-admin")
+	server.AddComposite(testRealm, otherAdmin, source)
+	alice := server.CreateUser(testRealm, "alice")
+	server.GrantRole(testRealm, alice, source)
+	ops := server.CreateGroup(testRealm, "ops")
+	server.GrantRole(testRealm, ops, source)
+	serviceAccount := server.ServiceAccountUserId(testRealm, testClientId)
+	server.GrantRole(testRealm, serviceAccount, source)
+	config := testProviderConfig(server) + testRoleMigrationConfig(testClientId, "tenant-reader", "", "tenant-reader")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: config,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_role_migration.migration", "id", testRealm+"/"+testClientId+"/tenant-reader//tenant-reader"),
+					func(s *terraform.State) error {
+						if server.ClientRole(testRealm, testClientId, "tenant-reader") != nil {
+							return fmt.Errorf("client role tenant-reader still exists")
+						}
+						target := server.RealmRole(testRealm, "tenant-reader")
+						if target == nil {
+							return fmt.Errorf("realm role tenant-reader does not exist")
+						}
+						if err := resource.TestCheckResourceAttr("embracecloud_role_migration.migration", "target_keycloak_id", *target.ID)(s); err != nil {
+							return err
+						}
+						if *target.Description != "reads tenants" {
+							return fmt.Errorf("expected the description to be copied, got %q", *target.Description)
+						}
+						if expected := map[string][]string{"scope": {"tenant", "global"}}; !reflect.DeepEqual(*target.Attributes, expected) {
+							return fmt.Errorf("expected attributes %v to be copied, got %v", expected, *target.Attributes)
+						}
+						for _, holder := range []string{alice, ops, serviceAccount} {
+							if !server.HasRole(testRealm, holder, *target.ID) {
+								return fmt.Errorf("expected %s to be granted realm role tenant-reader", holder)
+							}
+						}
+						return nil
+					},
+					testAccCheckRealmRoleComposites(server, "tenant-reader", "base"),
+					testAccCheckComposites(server, admin, "tenant-reader"),
+					testAccCheckComposites(server, otherAdmin, "tenant-reader"),
+				),
+			},
+			{
+				// deleting the migration leaves the moved role alone
+				Config: testProviderConfig(server),
+				Check: func(s *terraform.State) error {
+					if server.RealmRole(testRealm, "tenant-reader") == nil {
+						return fmt.Errorf("realm role tenant-reader was deleted")
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRoleMigration_realmToClient(t *testing.T) {
+	server := testKeycloak(t)
+	source := server.CreateRealmRole(testRealm, "reader")
+	// more holders than keycloak lists at once
+	var users []string
+	for i := 0; i < 150; i++ {
+		user := server.CreateUser(testRealm, fmt.Sprintf("user-%d", i))
+		server.GrantRole(testRealm, user, source)
+		users = append(users, user)
+	}
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testRoleMigrationConfig("", "reader", testClientId, "tenant-reader"),
+				Check: func(s *terraform.State) error {
+					if server.RealmRole(testRealm, "reader") != nil {
+						return fmt.Errorf("realm role reader still exists")
+					}
+					target := server.ClientRole(testRealm, testClientId, "tenant-reader")
+					if target == nil {
+						return fmt.Errorf("client role tenant-reader does not exist")
+					}
+					for _, user := range users {
+						if !server.HasRole(testRealm, user, *target.ID) {
+							return fmt.Errorf("expected user %s to be granted client role tenant-reader", user)
+						}
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRoleMigration_resume(t *testing.T) {
+	server := testKeycloak(t)
+	source := server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	alice := server.CreateUser(testRealm, "alice")
+	server.GrantRole(testRealm, alice, source)
+	// left behind by a migration that failed before it granted the role
+	server.CreateRealmRole(testRealm, "tenant-reader")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testRoleMigrationConfig(testClientId, "tenant-reader", "", "tenant-reader"),
+				Check: func(s *terraform.State) error {
+					if server.ClientRole(testRealm, testClientId, "tenant-reader") != nil {
+						return fmt.Errorf("client role tenant-reader still exists")
+					}
+					if !server.HasRole(testRealm, alice, testRealmRoleId(server, "tenant-reader")) {
+						return fmt.Errorf("expected alice to be granted realm role tenant-reader")
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRoleMigration_existingTarget(t *testing.T) {
+	server := testKeycloak(t)
+	source := server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	server.UpdateRole(testRealm, source, "can read the tenant", map[string][]string{"tenant": {"a"}, "scope": {"read"}})
+	// a realm role of the same name someone already set up
+	target := server.CreateRealmRole(testRealm, "tenant-reader")
+	server.UpdateRole(testRealm, target, "reads every tenant", map[string][]string{"tenant": {"all"}})
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testRoleMigrationConfig(testClientId, "tenant-reader", "", "tenant-reader"),
+				Check: func(s *terraform.State) error {
+					role := server.RealmRole(testRealm, "tenant-reader")
+					if description := gocloak.PString(role.Description); description != "reads every tenant" {
+						return fmt.Errorf("expected the description of the target to be kept, got %s", description)
+					}
+					if expected := map[string][]string{"tenant": {"all"}, "scope": {"read"}}; !reflect.DeepEqual(*role.Attributes, expected) {
+						return fmt.Errorf("expected attributes %v, got %v", expected, *role.Attributes)
+					}
+					return nil
+				},
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRoleMigration_alreadyMigrated(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateRealmRole(testRealm, "tenant-reader")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testProviderConfig(server) + testRoleMigrationConfig(testClientId, "tenant-reader", "", "tenant-reader"),
+				ExpectError: regexp.MustCompile("source role tenant-reader of the migration to tenant-reader not found in realm test, if the migration is already done import it"),
+			},
+			{
+				Config:             testProviderConfig(server) + testRoleMigrationConfig(testClientId, "tenant-reader", "", "tenant-reader"),
+				ResourceName:       "embracecloud_role_migration.migration",
+				ImportState:        true,
+				ImportStateId:      testRealm + "/" + testClientId + "/tenant-reader//tenant-reader",
+				ImportStatePersist: true,
+			},
+			{
+				Config: testProviderConfig(server) + testRoleMigrationConfig(testClientId, "tenant-reader", "", "tenant-reader"),
+				Check:  resource.TestCheckResourceAttrSet("embracecloud_role_migration.migration", "target_keycloak_id"),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRoleMigration_misspelledSource(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateClientRole(testRealm, testClientId, "tenant-reader")
+	server.CreateRealmRole(testRealm, "tenant-reader")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testProviderConfig(server) + testRoleMigrationConfig(testClientId, "tenant-raeder", "", "tenant-reader"),
+				ExpectError: regexp.MustCompile("source role tenant-raeder of the migration to tenant-reader not found in realm test"),
+			},
+			{
+				// an import does not take a migration that did not happen for done
+				Config:        testProviderConfig(server) + testRoleMigrationConfig(testClientId, "tenant-reader", "", "tenant-reader"),
+				ResourceName:  "embracecloud_role_migration.migration",
+				ImportState:   true,
+				ImportStateId: testRealm + "/" + testClientId + "/tenant-reader//tenant-reader",
+				ExpectError:   regexp.MustCompile("source role tenant-reader of the migration to tenant-reader still exists in realm test"),
+			},
+		},
+	})
+}
+
+func TestResourceKeycloakRoleMigration_errors(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateRealmRole(testRealm, "reader")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				Config:      testProviderConfig(server) + testRoleMigrationConfig("", "reader", "", "reader"),
+				ExpectError: regexp.MustCompile("source and target of the migration are the same role reader"),
+			},
+			{
+				Config:      testProviderConfig(server) + testRoleMigrationConfig(testClientId, "tenant-reader", "", "tenant-reader"),
+				ExpectError: regexp.MustCompile("could not find client role in client test-client with name tenant-reader"),
+			},
+		},
+	})
+}
+
+func testRoleMigrationConfig(sourceClientId string, sourceRoleName string, targetClientId string, targetRoleName string) string {
+	return fmt.Sprintf(`
+resource "embracecloud_role_migration" "migration" {
+  realm_id         = %q
+  source_client_id = %q
+  source_role_name = %q
+  target_client_id = %q
+  target_role_name = %q
+}
+`, testRealm, sourceClientId, sourceRoleName, targetClientId, targetRoleName)
+}
@@ -2,9 +2,7 @@ package provider
 
 import (
 	"context"
-	"fmt"
 
-	"github.com/Nerzal/gocloak/v12"
 	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
@@ -43,7 +41,6 @@ func resourceKeycloakServiceAccountDetails() *schema.Resource {
 			"username": {
 				Type:     schema.TypeString,
 				Computed: true,
-				
 			},
 		},
 	}
@@ -51,38 +48,29 @@ func resourceKeycloakServiceAccountDetails() *schema.Resource {
 
 func resourceKeycloakServiceAccountDetailsCreate(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	realm := data.Get("realm_id").(string)
 	clientId := data.Get("client_id").(string)
 	firstName := data.Get("first_name").(string)
 	lastName := data.Get("last_name").(string)
 
-	var params = gocloak.GetClientsParams{
-		ClientID: &clientId,
-	}
-
-	clients, err := keycloakCLient.GetClients(ctx, token.AccessToken, realm, params)
-
+	idOfClient, err := keycloakCLient.GetClientUUID(ctx, realm, clientId)
 	if err != nil {
-		return diag.Errorf(fmt.Sprintf("cannot find client %s in realm %s", clientId, realm))
-	}
-	if len(clients) < 1 {
-		return diag.Errorf(fmt.Sprintf("Client %s not found in realm %s", clientId, realm))
-	}
-
-	if len(clients) > 1 {
-		return diag.Errorf("multiple clients found")
+		return diag.FromErr(err)
 	}
 
-	serviceAccountUser, err := keycloakCLient.GetClientServiceAccount(ctx, token.AccessToken, realm, *clients[0].ID)
+	serviceAccountUser, err := keycloakCLient.GetClientServiceAccount(ctx, realm, idOfClient)
 	if err != nil {
-
+		return diag.Errorf("could not find the service account of client %s in realm %s error -> %s", clientId, realm, err.Error())
 	}
 
 	serviceAccountUser.FirstName = &firstName
 	serviceAccountUser.LastName = &lastName
 
-	err = keycloakCLient.UpdateUser(ctx, token.AccessToken, realm, *serviceAccountUser)
+	err = keycloakCLient.UpdateUser(ctx, realm, *serviceAccountUser)
 	if err != nil {
 		return diag.FromErr(err)
 	}
@@ -96,24 +84,36 @@ func resourceKeycloakServiceAccountDetailsCreate(ctx context.Context, data *sche
 func resourceKeycloakServiceAccountDetailsRead(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	userId := data.Id()
 	realm := data.Get("realm_id").(string)
 
-	user, err := keycloakCLient.GetUserByID(ctx, token.AccessToken, realm, userId)
+	user, err := keycloakCLient.GetUserByID(ctx, realm, userId)
 	if err != nil {
+		// the service account went away with its client
+		if embracecloud.IsNotFound(err) {
+			data.SetId("")
+			return nil
+		}
 		return diag.FromErr(err)
 	}
 
 	data.Set("first_name", user.FirstName)
 	data.Set("last_name", user.LastName)
+	data.Set("username", user.Username)
 
 	return nil
 }
 
 func resourceKeycloakServiceAccountDetailsDelete(ctx context.Context, data *schema.ResourceData, meta interface{}) diag.Diagnostics {
 	client := meta.(*embracecloud.EmbraceCloudClient)
-	keycloakCLient, token := client.GetKeycloakClient()
+	keycloakCLient, err := client.GetKeycloakClient(ctx)
+	if err != nil {
+		return diag.FromErr(err)
+	}
 	realm := data.Get("realm_id").(string)
 	userId := data.Id()
 
@@ -123,18 +123,21 @@ func resourceKeycloakServiceAccountDetailsDelete(ctx context.Context, data *sche
 	firstName := data.Get("first_name").(string)
 	lastName := data.Get("last_name").(string)
 
-	user, err := keycloakCLient.GetUserByID(ctx, token.AccessToken, realm, userId)
+	user, err := keycloakCLient.GetUserByID(ctx, realm, userId)
 	if err != nil {
+		// nothing to reset, the service account went away with its client
+		if embracecloud.IsNotFound(err) {
+			return nil
+		}
 		return diag.FromErr(err)
 	}
 
 	user.FirstName = &firstName
 	user.LastName = &lastName
 
-	keycloakCLient.UpdateUser(ctx, token.AccessToken, realm, *user)
-
+	err = keycloakCLient.UpdateUser(ctx, realm, *user)
 	if err != nil {
-		return diag.FromErr(err)
+		return diag.Errorf("could not reset the name of the service account of client %s in realm %s error -> %s", data.Get("client_id").(string), realm, err.Error())
 	}
 
 	return nil
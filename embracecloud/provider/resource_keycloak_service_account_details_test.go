@@ -0,0 +1,110 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/resource"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/terraform"
+)
+
+func TestResourceKeycloakServiceAccountDetails_basic(t *testing.T) {
+	server := testKeycloak(t)
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		CheckDestroy:      testAccCheckServiceAccountName(server, "", ""),
+		Steps: []resource.TestStep{
+			{
+				Config: testProviderConfig(server) + testServiceAccountDetailsConfig("Test", "Client"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("embracecloud_serviceaccount_details.details", "username", "service-account-"+testClientId),
+					testAccCheckServiceAccountName(server, "Test", "Client"),
+				),
+			},
+			{
+				Config: testProviderConfig(server) + testServiceAccountDetailsConfig("Test", "Service"),
+				Check:  testAccCheckServiceAccountName(server, "Test", "Service"),
+			},
+			{
+				// the client and its service account were deleted and created
+				// again in the admin console
+				PreConfig: func() {
+					server.DeleteClient(testRealm, testClientId)
+					server.CreateClient(testRealm, testClientId)
+				},
+				Config: testProviderConfig(server) + testServiceAccountDetailsConfig("Test", "Service"),
+				Check:  testAccCheckServiceAccountName(server, "Test", "Service"),
+			},
+		},
+	})
+}
+
+func testServiceAccountDetailsConfig(firstName string, lastName string) string {
+	return fmt.Sprintf(`
+resource "embracecloud_serviceaccount_details" "details" {
+  realm_id   = %q
+  client_id  = %q
+  first_name = %q
+  last_name  = %q
+}
+`, testRealm, testClientId, firstName, lastName)
+}
+
+func testAccCheckServiceAccountName(server *keycloaktest.Server, firstName string, lastName string) resource.TestCheckFunc {
+	return func(s *terraform.State) error {
+		user := server.User(testRealm, server.ServiceAccountUserId(testRealm, testClientId))
+		if *user.FirstName != firstName || *user.LastName != lastName {
+			return fmt.Errorf("expected service account name %q %q, got %q %q", firstName, lastName, *user.FirstName, *user.LastName)
+		}
+		return nil
+	}
+}
+
+func TestResourceKeycloakServiceAccountDetailsDelete_clientDeleted(t *testing.T) {
+	server := testKeycloak(t)
+	userId := server.ServiceAccountUserId(testRealm, testClientId)
+
+	data := schema.TestResourceDataRaw(t, resourceKeycloakServiceAccountDetails().Schema, map[string]interface{}{
+		"realm_id":   testRealm,
+		"client_id":  testClientId,
+		"first_name": "Test",
+		"last_name":  "Client",
+	})
+	data.SetId(userId)
+
+	// the client went away between the refresh and the destroy
+	server.DeleteClient(testRealm, testClientId)
+	if diags := resourceKeycloakServiceAccountDetailsDelete(context.Background(), data, testProviderClient(server)); diags.HasError() {
+		t.Fatalf("expected nothing left to reset, got %v", diags)
+	}
+}
+
+func TestResourceKeycloakServiceAccountDetails_noServiceAccount(t *testing.T) {
+	server := testKeycloak(t)
+	server.CreateClient(testRealm, "other-client")
+
+	resource.UnitTest(t, resource.TestCase{
+		PreCheck:          func() { testAccPreCheckTerraform(t) },
+		ProviderFactories: testAccProviderFactories,
+		Steps: []resource.TestStep{
+			{
+				PreConfig: func() { server.DisableServiceAccount(testRealm, "other-client") },
+				Config: testProviderConfig(server) + fmt.Sprintf(`
+resource "embracecloud_serviceaccount_details" "details" {
+  realm_id   = %q
+  client_id  = "other-client"
+  first_name = "Other"
+  last_name  = "Client"
+}
+`, testRealm),
+				ExpectError: regexp.MustCompile("could not find the service account of client other-client in realm test"),
+			},
+		},
+	})
+}
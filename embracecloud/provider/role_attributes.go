@@ -0,0 +1,179 @@
+package provider
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/validation"
+)
+
+const (
+	attributesModeAuthoritative = "authoritative"
+	attributesModeMerge         = "merge"
+)
+
+// attributeSchema is the attribute block of embracecloud_realm_role and
+// embracecloud_client_role, one block for each multivalued keycloak attribute
+func attributeSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:          schema.TypeSet,
+		Optional:      true,
+		ConflictsWith: []string{"attributes"},
+		Description:   "an attribute of the role with all its values",
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"name": {
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"values": {
+					Type:     schema.TypeList,
+					Required: true,
+					Elem:     &schema.Schema{Type: schema.TypeString},
+				},
+			},
+		},
+	}
+}
+
+// attributesSchema is the attributes map the attribute blocks replaced, kept
+// for one release so existing configurations still work
+func attributesSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:          schema.TypeMap,
+		Optional:      true,
+		Elem:          &schema.Schema{Type: schema.TypeString},
+		ConflictsWith: []string{"attribute"},
+		Deprecated:    "use attribute blocks instead, attributes will be removed in the next release",
+		Description:   "attributes of the role, multiple values are joined with ##",
+	}
+}
+
+// attributesModeSchema selects whether the attribute blocks own all attributes
+// of a role or only the ones they name, so that attributes written by other
+// systems are kept. It is empty for roles created before it was added, which
+// are authoritative.
+func attributesModeSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeString,
+		Optional:     true,
+		ValidateFunc: validation.StringInSlice([]string{attributesModeAuthoritative, attributesModeMerge}, false),
+		Description:  "authoritative removes attributes that are not configured, merge only manages the configured attributes, defaults to authoritative",
+	}
+}
+
+// mergeRoleAttributes returns the current attributes of a role with the
+// attributes terraform manages replaced by the configuration. Attributes that
+// were removed from the configuration are removed, all others are kept.
+func mergeRoleAttributes(data *schema.ResourceData, current *map[string][]string) map[string][]string {
+	result := map[string][]string{}
+	if current != nil {
+		for name, values := range *current {
+			result[name] = values
+		}
+	}
+
+	oldAttribute, _ := data.GetChange("attribute")
+	oldAttributes, _ := data.GetChange("attributes")
+	for name := range roleAttributes(oldAttribute, oldAttributes) {
+		delete(result, name)
+	}
+	for name, values := range roleAttributes(data.Get("attribute"), data.Get("attributes")) {
+		result[name] = values
+	}
+
+	return result
+}
+
+// managedRoleAttributes drops the attributes terraform does not manage in
+// merge mode, so they are not reported as drift
+func managedRoleAttributes(data *schema.ResourceData, attributes *map[string][]string) *map[string][]string {
+	if data.Get("attributes_mode").(string) != attributesModeMerge || attributes == nil {
+		return attributes
+	}
+
+	managed := roleAttributes(data.Get("attribute"), data.Get("attributes"))
+	result := map[string][]string{}
+	for name, values := range *attributes {
+		if _, ok := managed[name]; ok {
+			result[name] = values
+		}
+	}
+	return &result
+}
+
+// roleAttributes returns the keycloak attributes of the attribute blocks or of
+// the deprecated attributes map, only one of them can be configured
+func roleAttributes(attribute interface{}, attributes interface{}) map[string][]string {
+	result := expandRoleAttributes(attribute.(*schema.Set))
+	for name, value := range attributes.(map[string]interface{}) {
+		result[name] = strings.Split(value.(string), MULTIVALUE_ATTRIBUTE_SEPARATOR)
+	}
+	return result
+}
+
+// setRoleAttributes stores keycloak attributes in the attributes map when the
+// role is managed with it and in attribute blocks otherwise
+func setRoleAttributes(data *schema.ResourceData, attributes *map[string][]string) {
+	if len(data.Get("attributes").(map[string]interface{})) == 0 {
+		data.Set("attribute", flattenRoleAttributes(attributes))
+		return
+	}
+
+	result := map[string]interface{}{}
+	if attributes != nil {
+		for name, values := range *attributes {
+			result[name] = strings.Join(values, MULTIVALUE_ATTRIBUTE_SEPARATOR)
+		}
+	}
+	data.Set("attribute", []interface{}{})
+	data.Set("attributes", result)
+}
+
+// expandRoleAttributes converts the attribute blocks into keycloak attributes
+func expandRoleAttributes(attributes *schema.Set) map[string][]string {
+	result := map[string][]string{}
+	for _, v := range attributes.List() {
+		attribute := v.(map[string]interface{})
+
+		values := []string{}
+		for _, value := range attribute["values"].([]interface{}) {
+			values = append(values, value.(string))
+		}
+		result[attribute["name"].(string)] = values
+	}
+	return result
+}
+
+// flattenRoleAttributes converts keycloak attributes into attribute blocks
+func flattenRoleAttributes(attributes *map[string][]string) []interface{} {
+	result := []interface{}{}
+	if attributes == nil {
+		return result
+	}
+
+	names := make([]string, 0, len(*attributes))
+	for name := range *attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		result = append(result, map[string]interface{}{
+			"name":   name,
+			"values": (*attributes)[name],
+		})
+	}
+	return result
+}
+
+// resourceKeycloakRoleStateUpgradeV0 upgrades state version 0 of realm and
+// client roles. Its attributes map, whose values were joined with
+// MULTIVALUE_ATTRIBUTE_SEPARATOR, stays in place as long as the deprecated
+// attributes argument exists, so configurations that still use it show no
+// changes.
+func resourceKeycloakRoleStateUpgradeV0(ctx context.Context, rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	return rawState, nil
+}
@@ -0,0 +1,111 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Nerzal/gocloak/v12"
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/diag"
+)
+
+// roleRenameWarnings lists what refers to a role that was renamed from oldName
+// to newName. Keycloak links composites and role mappings by id, so they keep
+// working, but configuration that names the role has to follow. idOfClient is
+// empty for realm roles.
+func roleRenameWarnings(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, idOfClient string, oldName string, newName string) diag.Diagnostics {
+	summary := fmt.Sprintf("role %s is renamed to %s", oldName, newName)
+
+	references, err := roleReferences(ctx, keycloakCLient, realm, idOfClient, newName)
+	if err != nil {
+		return diag.Diagnostics{{
+			Severity: diag.Warning,
+			Summary:  summary,
+			Detail:   fmt.Sprintf("could not list the composites and mappings that refer to it error -> %s", err.Error()),
+		}}
+	}
+	if len(references) == 0 {
+		return nil
+	}
+
+	return diag.Diagnostics{{
+		Severity: diag.Warning,
+		Summary:  summary,
+		Detail:   fmt.Sprintf("keycloak keeps the following, configuration that refers to the role as %s has to be updated: %s", oldName, strings.Join(references, ", ")),
+	}}
+}
+
+// roleReferences describes the realm roles, and for a client role the roles
+// of its client, the role is a composite of, and the users and groups it is
+// granted to directly
+func roleReferences(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, idOfClient string, roleName string) ([]string, error) {
+	var role *gocloak.Role
+	var err error
+	if idOfClient == "" {
+		role, err = keycloakCLient.GetRealmRole(ctx, realm, roleName)
+	} else {
+		role, err = keycloakCLient.GetClientRole(ctx, realm, idOfClient, roleName)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var idsOfClients []string
+	if idOfClient != "" {
+		idsOfClients = []string{idOfClient}
+	}
+	parents, err := compositeParents(ctx, keycloakCLient, realm, *role.ID, idsOfClients)
+	if err != nil {
+		return nil, err
+	}
+
+	var references []string
+	for _, parent := range parents {
+		if gocloak.PBool(parent.ClientRole) {
+			references = append(references, fmt.Sprintf("composite of client role %s", *parent.Name))
+		} else {
+			references = append(references, fmt.Sprintf("composite of realm role %s", *parent.Name))
+		}
+	}
+
+	users, groups, err := roleHolders(ctx, keycloakCLient, realm, idOfClient, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		references = append(references, fmt.Sprintf("granted to user %s", gocloak.PString(user.Username)))
+	}
+	for _, group := range groups {
+		references = append(references, fmt.Sprintf("granted to group %s", gocloak.PString(group.Path)))
+	}
+
+	return references, nil
+}
+
+// roleHolders returns the users, service accounts included, and the groups
+// the role is granted to directly. idOfClient is empty for realm roles.
+func roleHolders(ctx context.Context, keycloakCLient embracecloud.KeycloakAPI, realm string, idOfClient string, roleName string) ([]*gocloak.User, []*gocloak.Group, error) {
+	if idOfClient == "" {
+		users, err := keycloakCLient.GetUsersByRoleName(ctx, realm, roleName)
+		if err != nil {
+			return nil, nil, err
+		}
+		groups, err := keycloakCLient.GetGroupsByRole(ctx, realm, roleName)
+		if err != nil {
+			return nil, nil, err
+		}
+		return users, groups, nil
+	}
+
+	users, err := keycloakCLient.GetUsersByClientRoleName(ctx, realm, idOfClient, roleName)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups, err := keycloakCLient.GetGroupsByClientRole(ctx, realm, idOfClient, roleName)
+	if err != nil {
+		return nil, nil, err
+	}
+	return users, groups, nil
+}
@@ -0,0 +1,113 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/go-cty/cty"
+	"github.com/hashicorp/go-cty/cty/msgpack"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
+	"github.com/hashicorp/terraform-plugin-sdk/v2/helper/schema"
+)
+
+// the resources that rename their role in place
+var renamedRoleResources = []string{"embracecloud_realm_role", "embracecloud_client_role"}
+
+// unknownSettingsKey is the context key of the provider settings terraform did
+// not know yet when it configured the provider
+type unknownSettingsKey struct{}
+
+// providerServer serves the provider like the sdk does, it only remembers the
+// unknown settings before the sdk turns them into empty values
+type providerServer struct {
+	tfprotov5.ProviderServer
+	configType cty.Type
+	// state types of the resources whose renames are pointed out in the plan
+	renamedRoleTypes map[string]cty.Type
+}
+
+// Server returns the grpc server of the provider
+func Server() tfprotov5.ProviderServer {
+	provider := Provider()
+
+	renamedRoleTypes := map[string]cty.Type{}
+	for _, name := range renamedRoleResources {
+		renamedRoleTypes[name] = provider.ResourcesMap[name].CoreConfigSchema().ImpliedType()
+	}
+
+	return providerServer{
+		ProviderServer:   schema.NewGRPCProviderServer(provider),
+		configType:       schema.InternalMap(provider.Schema).CoreConfigSchema().ImpliedType(),
+		renamedRoleTypes: renamedRoleTypes,
+	}
+}
+
+func (s providerServer) ConfigureProvider(ctx context.Context, req *tfprotov5.ConfigureProviderRequest) (*tfprotov5.ConfigureProviderResponse, error) {
+	if req.Config != nil {
+		// a config the sdk can not read either is reported by the sdk
+		if config, err := msgpack.Unmarshal(req.Config.MsgPack, s.configType); err == nil && config.IsKnown() && !config.IsNull() {
+			unknown := map[string]bool{}
+			for key, value := range config.AsValueMap() {
+				if !value.IsKnown() {
+					unknown[key] = true
+				}
+			}
+			ctx = context.WithValue(ctx, unknownSettingsKey{}, unknown)
+		}
+	}
+
+	return s.ProviderServer.ConfigureProvider(ctx, req)
+}
+
+// settingUnknown tells if terraform did not know the value of key yet when it
+// configured the provider. d.GetRawConfig is always null in providerConfigure,
+// so the settings come from the context Server puts them on.
+func settingUnknown(ctx context.Context, key string) bool {
+	unknown, _ := ctx.Value(unknownSettingsKey{}).(map[string]bool)
+	return unknown[key]
+}
+
+// PlanResourceChange warns about a role that is renamed. The sdk cannot add
+// warnings to a plan and looking up what refers to the role would make every
+// plan slower, so the warning only names the role. The apply lists the
+// composites and mappings that refer to it.
+func (s providerServer) PlanResourceChange(ctx context.Context, req *tfprotov5.PlanResourceChangeRequest) (*tfprotov5.PlanResourceChangeResponse, error) {
+	resp, err := s.ProviderServer.PlanResourceChange(ctx, req)
+	if err != nil || resp == nil {
+		return resp, err
+	}
+
+	stateType, ok := s.renamedRoleTypes[req.TypeName]
+	if !ok || req.PriorState == nil || resp.PlannedState == nil {
+		return resp, nil
+	}
+	oldName, ok := roleName(req.PriorState, stateType)
+	if !ok {
+		return resp, nil
+	}
+	newName, ok := roleName(resp.PlannedState, stateType)
+	if !ok || newName == oldName {
+		return resp, nil
+	}
+
+	resp.Diagnostics = append(resp.Diagnostics, &tfprotov5.Diagnostic{
+		Severity: tfprotov5.DiagnosticSeverityWarning,
+		Summary:  fmt.Sprintf("role %s is renamed to %s", oldName, newName),
+		Detail:   fmt.Sprintf("keycloak keeps the composites and mappings of the role, configuration that refers to it as %s has to be updated. The apply lists what refers to it.", oldName),
+	})
+	return resp, nil
+}
+
+// roleName returns the known name of the role in state
+func roleName(state *tfprotov5.DynamicValue, stateType cty.Type) (string, bool) {
+	value, err := msgpack.Unmarshal(state.MsgPack, stateType)
+	if err != nil || !value.IsKnown() || value.IsNull() {
+		return "", false
+	}
+
+	name := value.GetAttr("name")
+	if !name.IsKnown() || name.IsNull() {
+		return "", false
+	}
+	return name.AsString(), true
+}
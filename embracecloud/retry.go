@@ -0,0 +1,97 @@
+package embracecloud
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// first wait between two attempts, it doubles with every attempt up to the
+// configured maximum and gets a random jitter on top
+const retryWaitTime = 500 * time.Millisecond
+
+// path of the openid connect token endpoint of a realm
+const tokenEndpointPath = "/protocol/openid-connect/token"
+
+// methods that can be sent again without changing the outcome
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// status codes keycloak or the load balancer in front of it answers with while
+// it is restarting or overloaded
+var retryableStatusCodes = map[int]bool{
+	http.StatusTooManyRequests:    true,
+	http.StatusBadGateway:         true,
+	http.StatusServiceUnavailable: true,
+	http.StatusGatewayTimeout:     true,
+}
+
+// configureRetries makes the resty client behind gocloak retry transient
+// failures with exponential backoff and jitter
+func configureRetries(restyClient *resty.Client, config KeycloakConfig) {
+	restyClient.SetRetryCount(config.MaxRetries)
+	restyClient.SetRetryWaitTime(retryWaitTime)
+	restyClient.SetRetryMaxWaitTime(config.MaxRetryWait)
+	restyClient.SetRetryAfter(retryAfter)
+	restyClient.AddRetryCondition(shouldRetry)
+}
+
+// shouldRetry retries failed idempotent requests. Any request answered with
+// 429 is retried as well since keycloak did not process it.
+func shouldRetry(resp *resty.Response, err error) bool {
+	if resp == nil || resp.Request == nil {
+		return false
+	}
+
+	if err == nil && resp.StatusCode() == http.StatusTooManyRequests {
+		return true
+	}
+
+	if !idempotentMethods[resp.Request.Method] && !isTokenRequest(resp.Request) {
+		return false
+	}
+
+	return err != nil || retryableStatusCodes[resp.StatusCode()]
+}
+
+// isTokenRequest tells whether the request goes to the token endpoint. Logins
+// and token refreshes are posted, but asking for another token changes
+// nothing in keycloak, so they are retried like idempotent requests.
+func isTokenRequest(req *resty.Request) bool {
+	if req.RawRequest != nil {
+		return strings.HasSuffix(req.RawRequest.URL.Path, tokenEndpointPath)
+	}
+	return strings.HasSuffix(req.URL, tokenEndpointPath)
+}
+
+// retryAfter honors the Retry-After header, given either in seconds or as a
+// date. Returning 0 makes resty fall back to its backoff, which is also used
+// for a date that already passed, e.g. because the clocks are skewed. resty
+// would wait the maximum for the negative duration.
+func retryAfter(_ *resty.Client, resp *resty.Response) (time.Duration, error) {
+	header := resp.Header().Get("Retry-After")
+	if header == "" {
+		return 0, nil
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		if wait := time.Until(date); wait > 0 {
+			return wait, nil
+		}
+		return 0, nil
+	}
+
+	return 0, nil
+}
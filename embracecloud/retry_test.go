@@ -0,0 +1,132 @@
+package embracecloud
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+	"github.com/go-resty/resty/v2"
+)
+
+func testResponse(header string) *resty.Response {
+	return &resty.Response{RawResponse: &http.Response{Header: http.Header{"Retry-After": {header}}}}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header   string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"3", 3 * time.Second},
+		{"soon", 0},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0},
+	}
+	for _, test := range tests {
+		if got, err := retryAfter(nil, testResponse(test.header)); err != nil || got != test.expected {
+			t.Errorf("expected Retry-After %q to wait %s, got %s %v", test.header, test.expected, got, err)
+		}
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if got, _ := retryAfter(nil, testResponse(future)); got <= 58*time.Minute || got > time.Hour {
+		t.Errorf("expected Retry-After %q to wait about an hour, got %s", future, got)
+	}
+}
+
+func TestRetryAfterInThePast(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	config := testConfig(server)
+	config.MaxRetries = 1
+	config.MaxRetryWait = 30 * time.Second
+	client := testClient(config)
+	testGetClients(t, client)
+
+	server.InjectFault(keycloaktest.Fault{
+		Method:     http.MethodGet,
+		Path:       "/clients$",
+		Status:     http.StatusServiceUnavailable,
+		RetryAfter: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat),
+		Times:      1,
+	})
+	started := time.Now()
+	testGetClients(t, client)
+
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("expected a Retry-After date in the past to fall back to the backoff, waited %s", elapsed)
+	}
+	if got := server.RequestCount(http.MethodGet, "/clients$"); got != 3 {
+		t.Errorf("expected the failed request to be retried once, got %d requests", got)
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	tests := []struct {
+		method   string
+		url      string
+		status   int
+		expected bool
+	}{
+		{http.MethodGet, "https://keycloak/admin/realms/test/clients", http.StatusServiceUnavailable, true},
+		{http.MethodGet, "https://keycloak/admin/realms/test/clients", http.StatusInternalServerError, false},
+		{http.MethodPost, "https://keycloak/admin/realms/test/roles", http.StatusServiceUnavailable, false},
+		{http.MethodPost, "https://keycloak/admin/realms/test/roles", http.StatusTooManyRequests, true},
+		{http.MethodPost, "https://keycloak/realms/master/protocol/openid-connect/token", http.StatusBadGateway, true},
+		{http.MethodPost, "https://keycloak/realms/master/protocol/openid-connect/token", http.StatusUnauthorized, false},
+	}
+	for _, test := range tests {
+		resp := &resty.Response{
+			Request:     &resty.Request{Method: test.method, URL: test.url},
+			RawResponse: &http.Response{StatusCode: test.status},
+		}
+		if got := shouldRetry(resp, nil); got != test.expected {
+			t.Errorf("expected retrying %s %s answered with %d to be %t", test.method, test.url, test.status, test.expected)
+		}
+	}
+}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	config := testConfig(server)
+	config.MaxRetries = 2
+	config.MaxRetryWait = 30 * time.Second
+	client := testClient(config)
+	testGetClients(t, client)
+
+	server.InjectFault(keycloaktest.Fault{
+		Method:     http.MethodGet,
+		Path:       "/clients$",
+		Status:     http.StatusServiceUnavailable,
+		RetryAfter: "1",
+		Times:      1,
+	})
+	started := time.Now()
+	testGetClients(t, client)
+
+	if elapsed := time.Since(started); elapsed < time.Second {
+		t.Errorf("expected the retry to wait the second asked for by Retry-After, waited %s", elapsed)
+	}
+	if got := server.RequestCount(http.MethodGet, "/clients$"); got != 3 {
+		t.Errorf("expected the failed request to be retried once, got %d requests", got)
+	}
+}
+
+func TestRetryLogin(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	config := testConfig(server)
+	config.MaxRetries = 2
+	config.MaxRetryWait = time.Second
+	// keycloak restarting behind its load balancer
+	server.InjectFault(keycloaktest.Fault{
+		Method: http.MethodPost,
+		Path:   tokenPath,
+		Status: http.StatusBadGateway,
+		Times:  2,
+	})
+
+	testGetClients(t, testClient(config))
+	if got := server.RequestCount(http.MethodPost, tokenPath); got != 3 {
+		t.Errorf("expected the login to be retried twice, got %d token requests", got)
+	}
+}
@@ -0,0 +1,130 @@
+package embracecloud
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Nerzal/gocloak/v12"
+)
+
+// configureTransport applies the tls, proxy, timeout, header, retry and
+// limiter settings of the config to the resty client behind gocloak
+func configureTransport(keycloak *gocloak.GoCloak, config KeycloakConfig) error {
+	tlsConfig, err := buildTLSConfig(config)
+	if err != nil {
+		return err
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	if config.ProxyUrl != "" {
+		proxyUrl, err := url.Parse(config.ProxyUrl)
+		if err != nil {
+			return fmt.Errorf("invalid keycloak proxy url %s error -> %s", config.ProxyUrl, err.Error())
+		}
+		transport.Proxy = http.ProxyURL(proxyUrl)
+	}
+
+	// the timeout starts once the limiter let the request through, waiting
+	// for a slot or the rate limit does not use it up
+	restyClient := keycloak.RestyClient()
+	restyClient.SetTransport(newLimitedTransport(newTimeoutTransport(transport, config.Timeout), config.MaxConcurrentRequests, config.RequestsPerSecond))
+	restyClient.SetHeaders(config.Headers)
+	configureRetries(restyClient, config)
+
+	return nil
+}
+
+// timeoutTransport gives every request timeout to be sent and answered,
+// including reading the body, like http.Client.Timeout does
+type timeoutTransport struct {
+	next    http.RoundTripper
+	timeout time.Duration
+}
+
+// newTimeoutTransport wraps next, a zero timeout leaves requests unlimited
+func newTimeoutTransport(next http.RoundTripper, timeout time.Duration) http.RoundTripper {
+	if timeout <= 0 {
+		return next
+	}
+
+	return &timeoutTransport{next: next, timeout: timeout}
+}
+
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(req.Context(), t.timeout)
+
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// the timeout also covers the body, it is cancelled once the body is closed
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: cancel}
+	return resp, nil
+}
+
+func buildTLSConfig(config KeycloakConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.TLSInsecureSkipVerify,
+	}
+
+	if config.CACert != "" {
+		caCert, err := readPEM(config.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read keycloak ca certificate error -> %s", err.Error())
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, errors.New("keycloak ca certificate does not contain any valid PEM certificate")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.ClientCert != "" || config.ClientKey != "" {
+		if config.ClientCert == "" || config.ClientKey == "" {
+			return nil, errors.New("keycloak client certificate and client key have to be set together")
+		}
+
+		clientCert, err := readPEM(config.ClientCert)
+		if err != nil {
+			return nil, fmt.Errorf("could not read keycloak client certificate error -> %s", err.Error())
+		}
+		clientKey, err := readPEM(config.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("could not read keycloak client key error -> %s", err.Error())
+		}
+
+		certificate, err := tls.X509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid keycloak client certificate error -> %s", err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// readPEM returns value itself when it holds PEM data, otherwise value is
+// taken as the path of a PEM file
+func readPEM(value string) ([]byte, error) {
+	if strings.Contains(value, "-----BEGIN") {
+		return []byte(value), nil
+	}
+
+	return os.ReadFile(value)
+}
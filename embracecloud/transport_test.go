@@ -0,0 +1,105 @@
+package embracecloud
+
+import (
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"sync/atomic"
+	"testing"
+
+	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/keycloaktest"
+)
+
+// testForward returns a handler that sends every request on to server
+func testForward(t *testing.T, server *keycloaktest.Server) http.Handler {
+	target, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return httputil.NewSingleHostReverseProxy(target)
+}
+
+func TestTransportCACert(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	tlsServer := httptest.NewTLSServer(testForward(t, server))
+	t.Cleanup(tlsServer.Close)
+
+	config := testConfig(server)
+	config.Url = tlsServer.URL
+	config.CACert = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tlsServer.Certificate().Raw}))
+	testGetClients(t, testClient(config))
+
+	config.CACert = ""
+	config.TLSInsecureSkipVerify = true
+	testGetClients(t, testClient(config))
+}
+
+func TestTransportHeaders(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	forward := testForward(t, server)
+	var missing int32
+	headerServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("X-Tenant") != "embrace" {
+			atomic.AddInt32(&missing, 1)
+		}
+		forward.ServeHTTP(w, req)
+	}))
+	t.Cleanup(headerServer.Close)
+
+	config := testConfig(server)
+	config.Url = headerServer.URL
+	config.Headers = map[string]string{"X-Tenant": "embrace"}
+	testGetClients(t, testClient(config))
+
+	if missing := atomic.LoadInt32(&missing); missing > 0 {
+		t.Errorf("expected every request to carry the configured header, %d did not", missing)
+	}
+}
+
+func TestTransportProxy(t *testing.T) {
+	server := keycloaktest.NewServer(t)
+	forward := testForward(t, server)
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&proxied, 1)
+		forward.ServeHTTP(w, req)
+	}))
+	t.Cleanup(proxy.Close)
+
+	config := testConfig(server)
+	// a name that does not resolve, only the proxy knows where to send it
+	config.Url = "http://keycloak.test"
+	config.ProxyUrl = proxy.URL
+	testGetClients(t, testClient(config))
+
+	if proxied := atomic.LoadInt32(&proxied); proxied != 2 {
+		t.Errorf("expected the login and the call to go through the proxy, got %d requests", proxied)
+	}
+}
+
+func TestBuildTLSConfigErrors(t *testing.T) {
+	tests := []struct {
+		config   KeycloakConfig
+		expected string
+	}{
+		{
+			KeycloakConfig{CACert: "-----BEGIN CERTIFICATE-----\ninvalid\n-----END CERTIFICATE-----"},
+			"keycloak ca certificate does not contain any valid PEM certificate",
+		},
+		{
+			KeycloakConfig{ClientCert: "-----BEGIN CERTIFICATE-----"},
+			"keycloak client certificate and client key have to be set together",
+		},
+		{
+			KeycloakConfig{CACert: "/does/not/exist.pem"},
+			"could not read keycloak ca certificate error -> open /does/not/exist.pem: no such file or directory",
+		},
+	}
+	for _, test := range tests {
+		if _, err := buildTLSConfig(test.config); err == nil || err.Error() != test.expected {
+			t.Errorf("expected %q, got %v", test.expected, err)
+		}
+	}
+}
@@ -3,11 +3,14 @@ package main
 import (
 	"github.com/embracesbs/terraform-provider-embracecloud/embracecloud/provider"
 
+	"github.com/hashicorp/terraform-plugin-go/tfprotov5"
 	"github.com/hashicorp/terraform-plugin-sdk/v2/plugin"
 )
 
 func main() {
 	plugin.Serve(&plugin.ServeOpts{
-		ProviderFunc: provider.Provider,
+		GRPCProviderFunc: func() tfprotov5.ProviderServer {
+			return provider.Server()
+		},
 	})
 }